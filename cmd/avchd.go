@@ -0,0 +1,196 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// avchdScanSize limits how much of AVCHD stream is searched for capture
+// time; cameras write it with the first frame.
+const avchdScanSize = 4 << 20
+
+const tsSync = 0x47
+
+// mdpmHeader starts H.264 SEI user data (Modified Digital Video Pack
+// Metadata) where AVCHD cameras record capture time and camera details.
+var mdpmHeader = []byte("\x17\xee\x8c\x60\xf8\x4d\x11\xd9\x8c\xd6\x08\x00\x20\x0c\x9a\x66MDPM")
+
+// MDPM tags of capture time.
+const (
+	mdpmDate = 0x18 // time zone, year (2 bytes) and month
+	mdpmTime = 0x19 // day, hour, minute and second
+)
+
+// decodeAvchdTimes reads capture time from MDPM of AVCHD stream, either
+// MPEG transport stream (.mts) or BDAV stream with 4 byte packet prefix
+// (.m2ts).
+func decodeAvchdTimes(r io.ReaderAt, size int64) ([]metadataTime, error) {
+	if size > avchdScanSize {
+		size = avchdScanSize
+	}
+	data := make([]byte, size)
+	if _, err := r.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("avchd: reading stream: %s", err)
+	}
+
+	streams, err := tsPayloads(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, stream := range streams {
+		if i := bytes.Index(stream, mdpmHeader); i >= 0 {
+			t, err := parseMdpm(stream[i+len(mdpmHeader):])
+			if err != nil {
+				return nil, err
+			}
+			return []metadataTime{{field: "MDPM", time: t}}, nil
+		}
+	}
+	return nil, nil
+}
+
+// tsPayloads returns payloads of transport stream packets, concatenated per
+// PID so that data split over packets is contiguous.
+func tsPayloads(data []byte) ([][]byte, error) {
+	var packetSize, prefix int
+	switch {
+	case len(data) > 188 && data[0] == tsSync && data[188] == tsSync:
+		packetSize, prefix = 188, 0
+	case len(data) > 196 && data[4] == tsSync && data[196] == tsSync:
+		packetSize, prefix = 192, 4
+	default:
+		return nil, errors.New("avchd: not a transport stream")
+	}
+
+	var pids []uint16
+	payloads := make(map[uint16][]byte)
+	for offset := 0; offset+packetSize <= len(data); offset += packetSize {
+		packet := data[offset+prefix : offset+packetSize]
+		if packet[0] != tsSync {
+			return nil, fmt.Errorf("avchd: lost sync at %d", offset)
+		}
+		pid := uint16(packet[1]&0x1f)<<8 | uint16(packet[2])
+		control := packet[3] >> 4 & 0x03
+		if control&0x01 == 0 {
+			continue // no payload
+		}
+		start := 4
+		if control&0x02 != 0 {
+			start += 1 + int(packet[4]) // adaptation field
+		}
+		if start >= len(packet) {
+			continue
+		}
+		if _, ok := payloads[pid]; !ok {
+			pids = append(pids, pid)
+		}
+		payloads[pid] = append(payloads[pid], packet[start:]...)
+	}
+
+	streams := make([][]byte, 0, len(pids))
+	for _, pid := range pids {
+		streams = append(streams, payloads[pid])
+	}
+	return streams, nil
+}
+
+// parseMdpm parses MDPM entries following the header: count followed by
+// tag and 4 bytes of value for each entry.
+func parseMdpm(data []byte) (time.Time, error) {
+	data = removeEmulationPrevention(data, 1+256*5)
+	if len(data) < 1 {
+		return time.Time{}, errors.New("avchd: truncated MDPM")
+	}
+	count := int(data[0])
+	data = data[1:]
+
+	values := make(map[byte][]byte)
+	for i := 0; i < count && len(data) >= 5; i++ {
+		values[data[0]] = data[1:5]
+		data = data[5:]
+	}
+	date, clock := values[mdpmDate], values[mdpmTime]
+	if date == nil || clock == nil {
+		return time.Time{}, errors.New("avchd: no capture time in MDPM")
+	}
+
+	var fields [7]int
+	for i, b := range []byte{date[1], date[2], date[3], clock[0], clock[1], clock[2], clock[3]} {
+		value, ok := bcd(b)
+		if !ok {
+			return time.Time{}, fmt.Errorf("avchd: invalid MDPM time % x % x", date, clock)
+		}
+		fields[i] = value
+	}
+	zone := mdpmZone(date[0])
+	t := time.Date(fields[0]*100+fields[1], time.Month(fields[2]), fields[3], fields[4], fields[5], fields[6], 0, zone)
+	if t.Month() != time.Month(fields[2]) || t.Day() != fields[3] {
+		return time.Time{}, fmt.Errorf("avchd: invalid MDPM date % x % x", date, clock)
+	}
+	return t, nil
+}
+
+// mdpmZone decodes MDPM time zone: bit 6 is daylight saving time, bit 5
+// sign, bits 4-1 hours and bit 0 half an hour. 0xff is unknown zone.
+func mdpmZone(value byte) *time.Location {
+	if value == 0xff {
+		return captureZone()
+	}
+	offset := time.Duration(value>>1&0x0f) * time.Hour
+	if value&0x01 != 0 {
+		offset += 30 * time.Minute
+	}
+	if value&0x20 != 0 {
+		offset = -offset
+	}
+	if value&0x40 != 0 {
+		offset += time.Hour
+	}
+	return time.FixedZone("", int(offset/time.Second))
+}
+
+// removeEmulationPrevention removes 0x03 bytes H.264 inserts after two zero
+// bytes, returning at most limit bytes.
+func removeEmulationPrevention(data []byte, limit int) []byte {
+	result := make([]byte, 0, limit)
+	zeros := 0
+	for _, b := range data {
+		if len(result) == limit {
+			break
+		}
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		result = append(result, b)
+	}
+	return result
+}
+
+// bcd decodes binary coded decimal byte.
+func bcd(b byte) (int, bool) {
+	high, low := int(b>>4), int(b&0x0f)
+	return high*10 + low, high < 10 && low < 10
+}
@@ -0,0 +1,108 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// mkTransportStream splits payload over transport stream packets of given
+// PID, interleaved with packets of another stream.
+func mkTransportStream(payload []byte, pid uint16, prefix bool) []byte {
+	var data []byte
+	for len(payload) > 0 {
+		for _, packetPid := range []uint16{0x1100, pid} {
+			if prefix {
+				data = append(data, 0, 0, 0, 0)
+			}
+			// adaptation field with stuffing, then payload
+			packet := []byte{tsSync, byte(packetPid >> 8), byte(packetPid), 0x30, 7, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+			chunk := make([]byte, 188-len(packet))
+			if packetPid == pid {
+				n := copy(chunk, payload)
+				payload = payload[n:]
+			}
+			data = append(append(data, packet...), chunk...)
+		}
+	}
+	return data
+}
+
+func mkMdpm(entries ...[]byte) []byte {
+	data := append(make([]byte, 150), mdpmHeader...)
+	data = append(data, byte(len(entries)))
+	for _, entry := range entries {
+		data = append(data, entry...)
+	}
+	return data
+}
+
+func TestDecodeAvchdTimes(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{
+			"mts", mkTransportStream(mkMdpm([]byte{0x18, 0x02, 0x20, 0x12, 0x07}, []byte{0x19, 0x14, 0x09, 0x30, 0x00}), 0x1011, false),
+			"2012-07-14T09:30:00+01:00",
+		},
+		{
+			// minutes and seconds followed by tag 0x00 need emulation prevention
+			"m2ts", mkTransportStream(mkMdpm([]byte{0x70, 0, 0, 0, 0}, []byte{0x18, 0x62, 0x20, 0x12, 0x07}, []byte{0x19, 0x14, 0x09, 0x00, 0x00, 0x03}, []byte{0x00, 0, 0, 0, 0}), 0x1011, true),
+			"2012-07-14T09:00:00Z",
+		},
+	}
+
+	for _, test := range tests {
+		times, err := decodeAvchdTimes(bytes.NewReader(test.data), int64(len(test.data)))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		} else if len(times) != 1 {
+			t.Errorf("%s: unexpected times: %v", test.name, times)
+		} else if actual := times[0].time.Format(time.RFC3339); actual != test.expected {
+			t.Errorf("%s: expected:%s got:%s", test.name, test.expected, actual)
+		}
+	}
+
+	data := mkTransportStream(make([]byte, 1000), 0x1011, false)
+	if times, err := decodeAvchdTimes(bytes.NewReader(data), int64(len(data))); err != nil || len(times) != 0 {
+		t.Errorf("unexpected result: %v %v", times, err)
+	}
+	data = mkMkv()
+	if _, err := decodeAvchdTimes(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestMdpmZone(t *testing.T) {
+	tests := []struct {
+		value    byte
+		expected int
+	}{
+		{0x00, 0},
+		{0x02, 3600},
+		{0x22, -3600},
+		{0x0b, 5*3600 + 1800},
+		{0x42, 2 * 3600}, // daylight saving time
+	}
+	for _, test := range tests {
+		if _, offset := time.Date(2012, 7, 14, 0, 0, 0, 0, mdpmZone(test.value)).Zone(); offset != test.expected {
+			t.Errorf("0x%02x: expected:%d got:%d", test.value, test.expected, offset)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// aviTimeLayouts are formats of IDIT and ICRD chunks; cameras mostly write
+// ctime format, e.g. "THU OCT 21 14:11:01 2004", but some use exif format.
+var aviTimeLayouts = []string{
+	"Mon Jan 2 15:04:05 2006",
+	exifTimeLayout,
+	"2006/01/02 15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+}
+
+// aviTimeChunks lists chunks holding capture time, in order of preference,
+// and the lists they are found in.
+var aviTimeChunks = []struct {
+	list  string
+	chunk string
+}{
+	{"hdrl", "IDIT"},
+	{"INFO", "ICRD"},
+}
+
+// readRiffChunks returns contents of chunks with given ids found directly in
+// the list between start and end, or in its sub-lists of given types. Other
+// chunks, including the media data, are skipped without reading them.
+func readRiffChunks(r io.ReaderAt, start, end int64, lists map[string]bool, ids map[string]bool, chunks map[string][]byte) error {
+	header := make([]byte, 12)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return fmt.Errorf("riff: reading chunk at %d: %s", offset, err)
+		}
+		id := string(header[0:4])
+		length := int64(binary.LittleEndian.Uint32(header[4:8]))
+		if offset+8+length > end {
+			// truncated files are common; use what was read so far
+			return nil
+		}
+
+		if id == "LIST" && length >= 4 {
+			if _, err := r.ReadAt(header[8:12], offset+8); err != nil {
+				return fmt.Errorf("riff: reading list at %d: %s", offset, err)
+			}
+			if lists[string(header[8:12])] {
+				if err := readRiffChunks(r, offset+12, offset+8+length, lists, ids, chunks); err != nil {
+					return err
+				}
+			}
+		} else if ids[id] {
+			data := make([]byte, length)
+			if _, err := r.ReadAt(data, offset+8); err != nil {
+				return fmt.Errorf("riff: reading %s chunk: %s", id, err)
+			}
+			chunks[id] = data
+		}
+		offset += 8 + length + length%2 // chunks are padded to even size
+	}
+	return nil
+}
+
+// decodeAviTimes reads IDIT chunk written by cameras into AVI header, or
+// ICRD creation date of INFO list.
+func decodeAviTimes(r io.ReaderAt, size int64) ([]metadataTime, error) {
+	header := make([]byte, 12)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("avi: reading header: %s", err)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "AVI " {
+		return nil, errors.New("avi: not an avi file")
+	}
+	end := 8 + int64(binary.LittleEndian.Uint32(header[4:8]))
+	if end > size {
+		end = size
+	}
+
+	lists := make(map[string]bool)
+	ids := make(map[string]bool)
+	for _, field := range aviTimeChunks {
+		lists[field.list] = true
+		ids[field.chunk] = true
+	}
+	chunks := make(map[string][]byte)
+	if err := readRiffChunks(r, 12, end, lists, ids, chunks); err != nil {
+		return nil, err
+	}
+
+	var times []metadataTime
+	for _, field := range aviTimeChunks {
+		data, ok := chunks[field.chunk]
+		if !ok {
+			continue
+		}
+		if t, err := parseAviTime(string(data)); err == nil {
+			times = append(times, metadataTime{field: field.chunk, time: t})
+		}
+	}
+	return times, nil
+}
+
+// parseAviTime parses camera local time, which is in capture zone. Runs of
+// spaces, as in ctime format days, are collapsed before parsing.
+func parseAviTime(value string) (time.Time, error) {
+	value = strings.Join(strings.Fields(strings.TrimRight(value, "\x00")), " ")
+	for _, layout := range aviTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, captureZone()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("avi: unrecognized time '%s'", value)
+}
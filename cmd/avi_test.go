@@ -0,0 +1,63 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func mkAvi(chunks ...[]byte) []byte {
+	return mkRiffChunk("RIFF", append([]byte("AVI "), bytes.Join(chunks, nil)...))
+}
+
+func mkRiffList(typ string, chunks ...[]byte) []byte {
+	return mkRiffChunk("LIST", append([]byte(typ), bytes.Join(chunks, nil)...))
+}
+
+func TestDecodeAviTimes(t *testing.T) {
+	assumedZone = time.FixedZone("", 3600)
+	defer func() { assumedZone = nil }()
+
+	data := mkAvi(
+		mkRiffList("hdrl", mkRiffChunk("avih", make([]byte, 56)), mkRiffChunk("IDIT", []byte("THU OCT  7 14:11:01 2004\n\x00"))),
+		mkRiffList("INFO", mkRiffChunk("ICRD", []byte("2004-10-07 14:11:00\x00"))),
+		mkRiffList("movi", mkRiffChunk("00dc", make([]byte, 101))),
+	)
+	times, err := decodeAviTimes(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{"IDIT 2004-10-07T14:11:01+01:00", "ICRD 2004-10-07T14:11:00+01:00"}
+	if len(times) != len(expected) {
+		t.Fatalf("unexpected times: %v", times)
+	}
+	for i, time := range times {
+		if actual := time.field + " " + time.time.Format("2006-01-02T15:04:05Z07:00"); actual != expected[i] {
+			t.Errorf("expected:%s got:%s", expected[i], actual)
+		}
+	}
+
+	data = mkAvi(mkRiffList("hdrl", mkRiffChunk("IDIT", []byte("2005:08:17 11:42:43"))))
+	if times, err := decodeAviTimes(bytes.NewReader(data), int64(len(data))); err != nil || len(times) != 1 {
+		t.Errorf("unexpected result: %v %v", times, err)
+	}
+
+	data = mkWebp()
+	if _, err := decodeAviTimes(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"time"
+)
+
+// errNoBirthTime is returned on systems and file systems which do not
+// record file creation time.
+var errNoBirthTime = errors.New("file system does not report birth time")
+
+// btimeTimeSource uses file creation (birth) time. Unlike modification time
+// it survives edits, but not copies.
+type btimeTimeSource struct{}
+
+func (btimeTimeSource) Name() string {
+	return "btime"
+}
+
+func (btimeTimeSource) Extract(file *fileinfo) (time.Time, confidence, error) {
+	btime, err := fileBirthTime(file.path)
+	if err != nil {
+		return time.Time{}, confidenceNone, err
+	}
+	if btime.After(file.info.ModTime()) {
+		// copied with modification time preserved; btime is time of copy
+		return time.Time{}, confidenceNone, errNoTime
+	}
+	return btime.In(captureZone()), confidenceLow, nil
+}
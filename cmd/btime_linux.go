@@ -0,0 +1,82 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux && (386 || amd64 || arm || arm64 || riscv64)
+// +build linux
+// +build 386 amd64 arm arm64 riscv64
+
+package cmd
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	atFdcwd           = -100
+	atSymlinkNofollow = 0x100
+	statxBtime        = 0x800
+)
+
+// statxTimestamp and statxResult mirror struct statx_timestamp and struct
+// statx of linux/stat.h.
+type statxTimestamp struct {
+	sec      int64
+	nsec     uint32
+	reserved int32
+}
+
+type statxResult struct {
+	mask           uint32
+	blksize        uint32
+	attributes     uint64
+	nlink          uint32
+	uid            uint32
+	gid            uint32
+	mode           uint16
+	_              uint16
+	ino            uint64
+	size           uint64
+	blocks         uint64
+	attributesMask uint64
+	atime          statxTimestamp
+	btime          statxTimestamp
+	ctime          statxTimestamp
+	mtime          statxTimestamp
+	_              [32]uint32
+}
+
+// fileBirthTime returns creation time of the file using statx(2), available
+// since linux 4.11. Symbolic links are not followed, as with modification
+// time found while walking directories.
+func fileBirthTime(path string) (time.Time, error) {
+	name, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var stx statxResult
+	dirfd := atFdcwd
+	_, _, errno := syscall.Syscall6(sysStatx, uintptr(dirfd), uintptr(unsafe.Pointer(name)),
+		atSymlinkNofollow, statxBtime, uintptr(unsafe.Pointer(&stx)), 0)
+	if errno == syscall.ENOSYS {
+		return time.Time{}, errNoBirthTime
+	} else if errno != 0 {
+		return time.Time{}, errno
+	}
+	if stx.mask&statxBtime == 0 {
+		return time.Time{}, errNoBirthTime
+	}
+	return time.Unix(stx.btime.sec, int64(stx.btime.nsec)), nil
+}
@@ -0,0 +1,25 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux || !(386 || amd64 || arm || arm64 || riscv64)
+// +build !linux !386,!amd64,!arm,!arm64,!riscv64
+
+package cmd
+
+import "time"
+
+// fileBirthTime is not implemented on this system.
+func fileBirthTime(path string) (time.Time, error) {
+	return time.Time{}, errNoBirthTime
+}
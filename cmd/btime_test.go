@@ -0,0 +1,66 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBirthTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "photo-cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "photo.jpg")
+	before := time.Now().Add(-time.Second)
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	btime, err := fileBirthTime(path)
+	if err == errNoBirthTime {
+		t.Skip("file system does not report birth time")
+	} else if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if btime.Before(before) || btime.After(time.Now().Add(time.Second)) {
+		t.Errorf("unexpected birth time: %s", btime)
+	}
+
+	file := mkFakeFile(path)
+	file.info = mkInfo(path)
+	if _, confidence, err := (btimeTimeSource{}).Extract(file); err != nil || confidence != confidenceLow {
+		t.Errorf("unexpected result: %s %s", confidence, err)
+	}
+
+	// copy with preserved modification time
+	mtime := time.Date(2015, 6, 7, 8, 9, 10, 0, time.UTC)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	file.info = mkInfo(path)
+	if _, _, err := (btimeTimeSource{}).Extract(file); err != errNoTime {
+		t.Errorf("expected errNoTime, got: %v", err)
+	}
+
+	if _, err := fileBirthTime(filepath.Join(dir, "missing.jpg")); err == nil {
+		t.Error("expected error")
+	}
+}
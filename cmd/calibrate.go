@@ -0,0 +1,135 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xor-gate/goexif2/exif"
+)
+
+var calibrateFrom string
+var calibrateTo string
+var calibrateRulesFile string
+
+// calibrateCmd represents the calibrate command
+var calibrateCmd = &cobra.Command{
+	Use:   "calibrate photo time",
+	Short: "Compute clock correction rule from a photo of a reference clock.",
+	Long: `Compute clock correction rule from a photo of a reference clock.
+
+Take a photo of a clock showing correct time, e.g. a phone screen, and pass
+the time shown on the clock, in yyyy-mm-dd HH:MM:SS format. The difference
+between the clock and the time recorded by the camera is printed as a rule
+matching the camera make, model and serial number. The rule can be appended to
+the rules file with --rules and later used with organize --clock-rules.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runCalibrate(args[0], args[1]); err != nil {
+			Print("Error: %s\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(calibrateCmd)
+
+	calibrateCmd.Flags().StringVar(&calibrateFrom, "from", "", "Apply the rule only to photos taken at or after this camera time.")
+	calibrateCmd.Flags().StringVar(&calibrateTo, "to", "", "Apply the rule only to photos taken before this camera time.")
+	calibrateCmd.Flags().StringVar(&calibrateRulesFile, "rules", "", "Append the rule to this rules file, creating it if needed.")
+}
+
+func runCalibrate(path, reference string) error {
+	rule, err := calibrate(path, reference)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(rule, "", "  ")
+	if err != nil {
+		return err
+	}
+	Print("%s\n", data)
+
+	if calibrateRulesFile == "" || dryRun {
+		return nil
+	}
+	return appendClockRule(calibrateRulesFile, rule)
+}
+
+// calibrate returns rule correcting the camera which took the photo of a
+// clock showing the reference time.
+func calibrate(path, reference string) (*clockRule, error) {
+	actual, err := parseClockTime(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	is, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer is.Close()
+
+	x, err := decodeExif(is, &fileinfo{path: path, info: info})
+	if err != nil {
+		return nil, fmt.Errorf("%s: error reading exif (%s)", path, err)
+	}
+	camera, _, err := exifWallTime(x, exif.DateTimeOriginal, exif.DateTime)
+	if err != nil {
+		return nil, fmt.Errorf("%s: no capture time (%s)", path, err)
+	}
+
+	metadata := exifMetadata(x)
+	rule := &clockRule{
+		Make:   metadata[metadataMake],
+		Model:  metadata[metadataModel],
+		Serial: metadata[metadataSerial],
+		From:   calibrateFrom,
+		To:     calibrateTo,
+		Offset: actual.Sub(camera).Round(time.Second).String(),
+	}
+	if err := rule.compile(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// appendClockRule adds the rule to the end of the rules file.
+func appendClockRule(path string, rule *clockRule) error {
+	var rules []*clockRule
+	if _, err := os.Stat(path); err == nil {
+		if rules, err = loadClockRules(path); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	rules = append(rules, rule)
+
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
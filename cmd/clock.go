@@ -0,0 +1,169 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/xor-gate/goexif2/exif"
+)
+
+// clockRule corrects time of photos taken by a camera whose clock was set
+// wrong. Make, Model and Serial are matched against exif fields, ignoring
+// case; empty ones match any camera. From and To limit the rule to photos
+// taken within the window, as seen on the camera clock. Offset is added to
+// the camera time, e.g. "-1h" for a clock left on summer time.
+type clockRule struct {
+	Make   string `json:"make,omitempty"`
+	Model  string `json:"model,omitempty"`
+	Serial string `json:"serial,omitempty"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Offset string `json:"offset"`
+
+	from   time.Time
+	to     time.Time
+	offset time.Duration
+}
+
+// clockRulesFile is the file given with --clock-rules.
+var clockRulesFile string
+
+var clockRules []*clockRule
+
+// clockTimeLayouts are accepted for rule windows and reference times.
+var clockTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// clockCorrectedSources lists time sources which report camera clock and
+// are therefore subject to clock rules.
+var clockCorrectedSources = map[string]bool{
+	"exif": true,
+}
+
+// parseClockTime parses time as seen on a clock, i.e. wall time without
+// zone, which is represented in UTC.
+func parseClockTime(value string) (time.Time, error) {
+	for _, layout := range clockTimeLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', expected yyyy-mm-dd HH:MM:SS", value)
+}
+
+// compile parses window and offset of the rule.
+func (this *clockRule) compile() error {
+	var err error
+	if this.offset, err = time.ParseDuration(this.Offset); err != nil {
+		return fmt.Errorf("invalid offset '%s'", this.Offset)
+	}
+	if this.From != "" {
+		if this.from, err = parseClockTime(this.From); err != nil {
+			return err
+		}
+	}
+	if this.To != "" {
+		if this.to, err = parseClockTime(this.To); err != nil {
+			return err
+		}
+	}
+	if !this.from.IsZero() && !this.to.IsZero() && !this.from.Before(this.to) {
+		return fmt.Errorf("window %s - %s is empty", this.From, this.To)
+	}
+	return nil
+}
+
+func matchClockField(pattern, value string) bool {
+	return pattern == "" || strings.EqualFold(strings.TrimSpace(pattern), value)
+}
+
+// matches returns true if the rule applies to the camera identified by
+// metadata, for the time recorded by it.
+func (this *clockRule) matches(metadata map[string]string, t time.Time) bool {
+	if !matchClockField(this.Make, metadata[metadataMake]) ||
+		!matchClockField(this.Model, metadata[metadataModel]) ||
+		!matchClockField(this.Serial, metadata[metadataSerial]) {
+		return false
+	}
+	wall := wallTimeIn(t, time.UTC)
+	if !this.from.IsZero() && wall.Before(this.from) {
+		return false
+	}
+	if !this.to.IsZero() && !wall.Before(this.to) {
+		return false
+	}
+	return true
+}
+
+// parseClockRules parses JSON array of rules.
+func parseClockRules(data []byte) ([]*clockRule, error) {
+	var rules []*clockRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	for i, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("rule %d: %s", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+func loadClockRules(path string) ([]*clockRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseClockRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return rules, nil
+}
+
+// findClockRule returns the first rule matching the candidate time of the
+// file, or nil. GPS time comes from satellites rather than the camera clock
+// and is never corrected.
+func findClockRule(rules []*clockRule, file *fileinfo, candidate *timeCandidate) *clockRule {
+	if !clockCorrectedSources[candidate.source] || candidate.field == string(exif.GPSDateStamp) {
+		return nil
+	}
+	for _, rule := range rules {
+		if rule.matches(file.metadata, candidate.time) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// correctClock applies the first matching clock rule to the candidate time.
+func correctClock(file *fileinfo, candidate *timeCandidate) {
+	rule := findClockRule(clockRules, file, candidate)
+	if rule == nil {
+		return
+	}
+	candidate.time = candidate.time.Add(rule.offset)
+	candidate.correction = rule.offset
+	Info("\r%s: camera clock corrected by %s\n", file.path, rule.offset)
+}
@@ -0,0 +1,165 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xor-gate/goexif2/exif"
+)
+
+func TestParseClockRules(t *testing.T) {
+	rules, err := parseClockRules([]byte(`[
+		{"make": "Canon", "offset": "-1h"},
+		{"serial": "123", "from": "2019-03-31", "to": "2019-10-27 03:00:00", "offset": "2m30s"}
+	]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rules) != 2 || rules[0].offset != -time.Hour || rules[1].offset != 150*time.Second {
+		t.Errorf("unexpected rules: %v", rules)
+	}
+	if !rules[1].from.Equal(time.Date(2019, 3, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected from: %s", rules[1].from)
+	}
+
+	invalid := []string{
+		`{"offset": "1h"}`,
+		`[{"offset": "one hour"}]`,
+		`[{"offset": "1h", "from": "yesterday"}]`,
+		`[{"offset": "1h", "from": "2019-01-02", "to": "2019-01-01"}]`,
+	}
+	for _, data := range invalid {
+		if _, err := parseClockRules([]byte(data)); err == nil {
+			t.Errorf("%s: expected error", data)
+		}
+	}
+}
+
+func TestFindClockRule(t *testing.T) {
+	rules, err := parseClockRules([]byte(`[
+		{"make": "canon", "model": "Canon EOS 80D", "serial": "42", "offset": "1h"},
+		{"make": "canon", "from": "2019-06-01", "to": "2019-07-01", "offset": "2h"},
+		{"model": "X-T2", "offset": "3h"}
+	]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	canon := map[string]string{metadataMake: "Canon", metadataModel: "Canon EOS 80D"}
+	tests := []struct {
+		metadata map[string]string
+		time     time.Time
+		source   string
+		offset   time.Duration
+	}{
+		{map[string]string{metadataMake: "Canon", metadataModel: "Canon EOS 80D", metadataSerial: "42"}, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), "exif", time.Hour},
+		{canon, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), "exif", 0},
+		{canon, time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC), "exif", 2 * time.Hour},
+		{canon, time.Date(2019, 6, 30, 23, 59, 59, 0, time.UTC), "exif", 2 * time.Hour},
+		{canon, time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC), "exif", 0},
+		// window is compared to camera clock, not to UTC
+		{canon, time.Date(2019, 7, 1, 1, 0, 0, 0, time.FixedZone("", 2*3600)), "exif", 0},
+		{canon, time.Date(2019, 6, 15, 0, 0, 0, 0, time.UTC), "mtime", 0},
+		{map[string]string{metadataMake: "FUJIFILM", metadataModel: "X-T2"}, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), "exif", 3 * time.Hour},
+		{nil, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), "exif", 0},
+	}
+
+	for i, test := range tests {
+		file := &fileinfo{metadata: test.metadata}
+		candidate := &timeCandidate{source: test.source, time: test.time}
+		var offset time.Duration
+		if rule := findClockRule(rules, file, candidate); rule != nil {
+			offset = rule.offset
+		}
+		if offset != test.offset {
+			t.Errorf("%d: offset expected:%s got:%s", i, test.offset, offset)
+		}
+	}
+
+	gps := &timeCandidate{source: "exif", field: string(exif.GPSDateStamp), time: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if rule := findClockRule(rules, &fileinfo{metadata: map[string]string{metadataModel: "X-T2"}}, gps); rule != nil {
+		t.Errorf("unexpected rule for GPS time: %v", rule)
+	}
+}
+
+func TestClockCorrection(t *testing.T) {
+	defer func() {
+		clockRules = nil
+	}()
+
+	var err error
+	clockRules, err = parseClockRules([]byte(`[{"make": "Canon", "model": "Canon EOS 5D Mark III", "offset": "-10h"}]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	setDirectoryFormat(t, "yyyy/mm/dd")
+
+	files := []*fileinfo{
+		{path: "../test/canon-20160710.cr2", info: mkInfo("../test/canon-20160710.cr2")},
+		{path: "../test/nikon-20150520.nef", info: mkInfo("../test/nikon-20150520.nef")},
+	}
+	evaluate(files, "dest")
+
+	if files[0].newPath != "dest/2016/07/09/canon-20160710.cr2" {
+		t.Errorf("unexpected newPath: %s", files[0].newPath)
+	}
+	if files[0].clockCorrection != -10*time.Hour {
+		t.Errorf("unexpected correction: %s", files[0].clockCorrection)
+	}
+	if files[1].newPath != "dest/2015/05/20/nikon-20150520.nef" || files[1].clockCorrection != 0 {
+		t.Errorf("unexpected correction of %s: %s", files[1].newPath, files[1].clockCorrection)
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	rule, err := calibrate("../test/canon-20160710.cr2", "2016-07-10 10:09:07")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rule.Make != "Canon" || rule.Model != "Canon EOS 5D Mark III" || rule.Offset != "1h1m0s" {
+		t.Errorf("unexpected rule: %+v", rule)
+	}
+
+	if _, err := calibrate("../test/no-exif.jpg", "2016-07-10 10:09:07"); err == nil {
+		t.Error("expected error for photo without time")
+	}
+	if _, err := calibrate("../test/canon-20160710.cr2", "10:09"); err == nil {
+		t.Error("expected error for invalid reference time")
+	}
+
+	dir, err := ioutil.TempDir("", "calibrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.json")
+	for i := 0; i < 2; i++ {
+		if err := appendClockRule(path, rule); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	rules, err := loadClockRules(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rules) != 2 || rules[1].offset != time.Hour+time.Minute {
+		t.Errorf("unexpected rules: %v", rules)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// companionFileTypes are extensions of files which belong to media with the
+// same base name, e.g. IMG_1234.THM thumbnail of IMG_1234.MOV, or
+// IMG_1234.AAE edits of IMG_1234.HEIC. They are moved with their media.
+var companionFileTypes = map[string]bool{
+	".thm": true,
+	".aae": true,
+}
+
+// isCompanionFile returns true for files which belong to media, by their
+// extension.
+func isCompanionFile(path string) bool {
+	return companionFileTypes[strings.ToLower(filepath.Ext(path))]
+}
+
+// companionGroup is a set of files in one directory sharing base name, e.g.
+// IMG_1234.CR2, IMG_1234.JPG and IMG_1234.THM, or still and video of a Live
+// Photo. Time of the whole group is
+// the time of its primary file, and the group is moved together.
+type companionGroup struct {
+	// media files, in order of preference for the primary
+	files []*fileinfo
+	// companions are files other than media, moved as sidecars of primary
+	companions []*fileinfo
+	primary    *fileinfo
+}
+
+// isPrimary returns true for files which are moved on their own or with
+// their companions, and false for those moved as companions of others.
+func (this *fileinfo) isPrimary() bool {
+	return this.group == nil || this.group.primary == this
+}
+
+// companionRank orders media of a group by preference for the primary; RAW
+// files carry the most complete meta data, videos the least.
+func companionRank(file *fileinfo) int {
+	ext := file.mediaType()
+	switch {
+	case rawFileTypes[ext]:
+		return 0
+	case heifFileTypes[ext] || jpegFileTypes[ext]:
+		return 1
+	case isVideo(ext):
+		return 3
+	}
+	return 2
+}
+
+// groupCompanions groups files by directory and base name. Files not
+// sharing base name with others are left alone, while companion files
+// without media are skipped.
+func groupCompanions(files []*fileinfo) {
+	groups := make(map[string]*companionGroup)
+	var keys []string
+	for _, file := range files {
+		file.group = nil
+		key := strings.TrimSuffix(file.path, filepath.Ext(file.path))
+		group, ok := groups[key]
+		if !ok {
+			group = &companionGroup{}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		if isCompanionFile(file.path) {
+			group.companions = append(group.companions, file)
+		} else {
+			group.files = append(group.files, file)
+		}
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		if len(group.files) == 0 {
+			for _, file := range group.companions {
+				file.message = fmt.Sprintf("%s: skipped, companion without media", file.path)
+				Info("\r%s\n", file.message)
+			}
+			continue
+		}
+		if len(group.files)+len(group.companions) < 2 {
+			continue
+		}
+		group.join()
+		for _, file := range group.companions {
+			Info("\r%s: companion, handled together with %s\n", file.path, group.primary.path)
+		}
+	}
+}
+
+// join orders media of the group by preference, makes the first the
+// primary and assigns the group to all its files.
+func (this *companionGroup) join() {
+	sort.SliceStable(this.files, func(i, j int) bool {
+		l, r := companionRank(this.files[i]), companionRank(this.files[j])
+		if l != r {
+			return l < r
+		}
+		return this.files[i].path < this.files[j].path
+	})
+	this.primary = this.files[0]
+	for _, file := range this.files {
+		file.group = this
+	}
+	for _, file := range this.companions {
+		file.group = this
+	}
+}
+
+// mergeCompanionGroups joins two files, with groups they belong to, into a
+// single group.
+func mergeCompanionGroups(a, b *fileinfo) {
+	group := &companionGroup{}
+	for _, file := range []*fileinfo{a, b} {
+		if file.group == nil {
+			group.files = append(group.files, file)
+		} else {
+			group.files = append(group.files, file.group.files...)
+			group.companions = append(group.companions, file.group.companions...)
+		}
+	}
+	group.join()
+}
+
+// isCompanion returns true for companion files of a group, which are not
+// evaluated on their own.
+func (this *fileinfo) isCompanion() bool {
+	if this.group == nil {
+		return false
+	}
+	for _, file := range this.group.companions {
+		if file == this {
+			return true
+		}
+	}
+	return false
+}
+
+// chooseCompanionPrimaries makes the most preferred file with known time the
+// primary of its group, and gives its time and destination to the other
+// files of the group. When the primary is not moved, neither is the rest of
+// the group.
+func chooseCompanionPrimaries(files []*fileinfo) {
+	for _, file := range files {
+		group := file.group
+		if group == nil || file != group.files[0] {
+			continue
+		}
+		for _, member := range group.files {
+			if !member.time.IsZero() {
+				group.primary = member
+				break
+			}
+		}
+
+		primary := group.primary
+		for _, member := range group.files {
+			if member == primary {
+				continue
+			}
+			member.time = primary.time
+			member.precision = primary.precision
+			member.timeSource = primary.timeSource
+			member.confidence = primary.confidence
+			member.newDir = primary.newDir
+			member.newPath = ""
+			if primary.newPath != "" {
+				member.newPath = filepath.Join(primary.newDir, filepath.Base(member.path))
+				member.message = ""
+			} else {
+				member.message = fmt.Sprintf("%s: not moved, %s is not moved", member.path, primary.path)
+				Info("\r%s\n", member.message)
+			}
+		}
+	}
+}
+
+// followCompanionPrimaries names other files of each group after its
+// primary, which may have been renamed, e.g. IMG_1234.JPG after
+// 20180304_123456.CR2. Companion files, and sidecars shared by files of the
+// group, become sidecars of the primary.
+func followCompanionPrimaries(files []*fileinfo) {
+	for _, file := range files {
+		group := file.group
+		if group == nil || file != group.primary {
+			continue
+		}
+
+		owned := make(map[string]bool)
+		for _, sidecar := range file.sidecars {
+			owned[sidecar.path] = true
+		}
+		for _, member := range group.files {
+			if member == file {
+				continue
+			}
+			if file.newPath != "" {
+				stem := strings.TrimSuffix(filepath.Base(file.newPath), filepath.Ext(file.newPath))
+				member.newDir = file.newDir
+				member.newPath = filepath.Join(file.newDir, stem+filepath.Ext(member.path))
+			}
+			var sidecars []sidecarFile
+			for _, sidecar := range member.sidecars {
+				if !owned[sidecar.path] {
+					owned[sidecar.path] = true
+					sidecars = append(sidecars, sidecar)
+				}
+			}
+			member.sidecars = sidecars
+		}
+		for _, companion := range group.companions {
+			companion.newDir = ""
+			companion.newPath = ""
+			if !owned[companion.path] {
+				owned[companion.path] = true
+				file.sidecars = append(file.sidecars, sidecarFile{
+					path:      companion.path,
+					suffix:    filepath.Ext(companion.path),
+					stem:      true,
+					companion: true,
+				})
+			}
+		}
+	}
+}
+
+// companionFiles returns the file followed by other media of its group.
+func companionFiles(file *fileinfo) []*fileinfo {
+	files := []*fileinfo{file}
+	if file.group != nil {
+		for _, member := range file.group.files {
+			if member != file {
+				files = append(files, member)
+			}
+		}
+	}
+	return files
+}
@@ -0,0 +1,257 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCompanions(t *testing.T) {
+	raw, err := ioutil.ReadFile("../test/canon-20160710.cr2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpeg, err := ioutil.ReadFile("../test/exif-20180101.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		sidecarMode = "move"
+		renameDuplicates = false
+		dryRun = false
+	}()
+	setDirectoryFormat(t, "yyyy/mm")
+	allFiles = false
+	minSize = 0
+	sidecarMode = "drop"
+
+	for _, rename := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "photo-cleanup")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		src := filepath.Join(dir, "src")
+		dest := filepath.Join(dir, "dest")
+
+		for name, data := range map[string][]byte{
+			// RAW is primary, so the JPEG of different date goes with it
+			"src/IMG_1234.CR2": raw,
+			"src/IMG_1234.JPG": jpeg,
+			"src/IMG_1234.xmp": []byte(sidecarXmp),
+			"src/IMG_1234.THM": jpeg,
+			"src/IMG_1234.AAE": []byte("<plist/>"),
+			// companion without media is left alone
+			"src/IMG_5678.AAE": []byte("<plist/>"),
+			"src/IMG_9999.JPG": jpeg,
+			// JPEG of another photo with the same name is already there
+			"dest/2016/07/IMG_1234.JPG": jpeg,
+		} {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		renameDuplicates = rename
+		InitProdOs()
+		files, err := getFiles(src, acceptExifFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		evaluate(files, dest)
+		excludeSidecars(files)
+		processDuplicates(files)
+		execute(files)
+
+		var got []string
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				rel, _ := filepath.Rel(dir, path)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		sort.Strings(got)
+
+		expected := []string{
+			"dest/2016/07/IMG_1234.JPG",
+			"dest/2018/01/IMG_9999.JPG",
+			"src/IMG_1234.AAE",
+			"src/IMG_1234.CR2",
+			"src/IMG_1234.JPG",
+			"src/IMG_1234.THM",
+			"src/IMG_1234.xmp",
+			"src/IMG_5678.AAE",
+		}
+		if rename {
+			// whole group is renamed the same way; XMP is dropped after
+			// being read, while companions are kept
+			expected = []string{
+				"dest/2016/07/IMG_1234-1.AAE",
+				"dest/2016/07/IMG_1234-1.CR2",
+				"dest/2016/07/IMG_1234-1.JPG",
+				"dest/2016/07/IMG_1234-1.THM",
+				"dest/2016/07/IMG_1234.JPG",
+				"dest/2018/01/IMG_9999.JPG",
+				"src/IMG_5678.AAE",
+			}
+		}
+		if len(got) != len(expected) {
+			t.Fatalf("rename %v: expected:%v got:%v", rename, expected, got)
+		}
+		for i := range got {
+			if got[i] != expected[i] {
+				t.Errorf("rename %v: expected:%s got:%s", rename, expected[i], got[i])
+			}
+		}
+	}
+}
+
+func TestFollowCompanionPrimaries(t *testing.T) {
+	defer func() { nameFormat = "" }()
+	nameFormat = "{yyyy}{mm}{dd}_{seq}.{ext}"
+
+	cr2 := &fileinfo{path: "src/IMG_1234.CR2", mediaExt: ".cr2"}
+	jpg := &fileinfo{path: "src/IMG_1234.JPG", mediaExt: ".jpg"}
+	mov := &fileinfo{path: "src/IMG_1234.MOV", mediaExt: ".mov"}
+	thm := &fileinfo{path: "src/IMG_1234.THM", mediaExt: ".thm"}
+	other := &fileinfo{path: "src/IMG_1235.JPG", mediaExt: ".jpg"}
+	files := []*fileinfo{jpg, thm, mov, cr2, other}
+	groupCompanions(files)
+
+	if cr2.group == nil || cr2.group.primary != cr2 || !thm.isCompanion() || other.group != nil {
+		t.Fatalf("unexpected grouping")
+	}
+	if len(cr2.group.files) != 3 || cr2.group.files[1] != jpg || cr2.group.files[2] != mov {
+		t.Errorf("unexpected order of files")
+	}
+
+	// RAW has no time, so JPEG becomes primary
+	jpg.time = time.Date(2018, 3, 4, 12, 0, 0, 0, time.UTC)
+	jpg.newDir = "dest/2018/03"
+	jpg.newPath = "dest/2018/03/IMG_1234.JPG"
+	other.time = jpg.time.Add(-time.Minute)
+	other.newDir = "dest/2018/03"
+	other.newPath = "dest/2018/03/IMG_1235.JPG"
+	chooseCompanionPrimaries(files)
+	if cr2.group.primary != jpg || !cr2.time.Equal(jpg.time) || cr2.newPath != "dest/2018/03/IMG_1234.CR2" {
+		t.Errorf("unexpected primary: %s %s", cr2.time, cr2.newPath)
+	}
+
+	applyNameFormat(files)
+	followCompanionPrimaries(files)
+	expected := map[*fileinfo]string{
+		other: "dest/2018/03/20180304_0001.JPG",
+		jpg:   "dest/2018/03/20180304_0002.JPG",
+		cr2:   "dest/2018/03/20180304_0002.CR2",
+		mov:   "dest/2018/03/20180304_0002.MOV",
+		thm:   "",
+	}
+	for file, newPath := range expected {
+		if file.newPath != newPath {
+			t.Errorf("%s: expected:%s got:%s", file.path, newPath, file.newPath)
+		}
+	}
+	if len(jpg.sidecars) != 1 || jpg.sidecars[0].newPath(jpg.newPath) != "dest/2018/03/20180304_0002.THM" {
+		t.Errorf("unexpected sidecars: %v", jpg.sidecars)
+	}
+}
+
+func TestCompanionsDeleteDuplicates(t *testing.T) {
+	jpeg, err := ioutil.ReadFile("../test/exif-20180101.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "photo-cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+
+	for name, data := range map[string][]byte{
+		"src/IMG_9999.JPG": jpeg,
+		"src/IMG_9999.THM": jpeg,
+		// companion without media is not organized even by file time
+		"src/IMG_5678.AAE":          []byte("<plist/>"),
+		"dest/2018/01/IMG_9999.JPG": jpeg,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func() {
+		useFileTime = false
+		deleteDuplicates = false
+		dryRun = false
+	}()
+	setDirectoryFormat(t, "yyyy/mm")
+	allFiles = false
+	minSize = 0
+	sidecarMode = "move"
+	useFileTime = true
+	deleteDuplicates = true
+
+	InitProdOs()
+	files, err := getFiles(src, acceptExifFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	evaluate(files, dest)
+	excludeSidecars(files)
+	processDuplicates(files)
+	execute(files)
+
+	var got []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			rel, _ := filepath.Rel(dir, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(got)
+
+	// duplicate is deleted, and its thumbnail moved next to the one kept
+	expected := []string{
+		"dest/2018/01/IMG_9999.JPG",
+		"dest/2018/01/IMG_9999.THM",
+		"src/IMG_5678.AAE",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected:%v got:%v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("expected:%s got:%s", expected[i], got[i])
+		}
+	}
+}
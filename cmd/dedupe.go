@@ -97,6 +97,7 @@ func deleteFile(path string) error {
 func dedupe(paths []string) error {
 	dupes := make(map[int64]*dupeList)
 	dupeCount := 0
+	var all []*fileinfo
 	for _, path := range paths {
 		files, err := getFiles(path, nil)
 		if err != nil {
@@ -118,6 +119,7 @@ func dedupe(paths []string) error {
 		})
 
 		dupeCount += len(files)
+		all = append(all, files...)
 		for _, info := range files {
 			if dup, ok := dupes[info.info.Size()]; ok {
 				dup.add(info)
@@ -127,6 +129,8 @@ func dedupe(paths []string) error {
 		}
 	}
 
+	findLivePhotoPartners(all)
+
 	// estimate how much memory we can use for in memory buffers
 	availableMemory, _ := GetAvailableMemory()
 	availableMemory = (availableMemory * 9) / 10
@@ -136,7 +140,10 @@ func dedupe(paths []string) error {
 		if len(dupeList.files) > 1 {
 			if size == 0 {
 				for i := 1; i < len(dupeList.files); i++ {
-					if emptyFilesAreIdentical {
+					if emptyFilesAreIdentical && dupeList.files[i].livePhoto != nil {
+						// deleted only with its pair, once all files are compared
+						dupeList.files[i].duplicateOf = dupeList.files[0]
+					} else if emptyFilesAreIdentical {
 						err := deleteFile(dupeList.files[i].path)
 						if err != nil {
 							return err
@@ -165,7 +172,7 @@ func dedupe(paths []string) error {
 	}
 	Print("Processed %d of %d files.\n", processed, dupeCount)
 
-	return nil
+	return deleteLivePhotoDuplicates(all)
 }
 
 func dedupeWorker(size int64, files []*fileinfo, availableMemory int64) error {
@@ -225,10 +232,13 @@ func dedupeWorker(size int64, files []*fileinfo, availableMemory int64) error {
 	}
 
 	// delete all files that are not beginning of a matchGroup, i.e. they are
-	// duplicates of the matchGroup leader
+	// duplicates of the matchGroup leader; Live Photos are deleted only as
+	// pairs, once all files are compared
 	Info("# Group:                         \n")
 	for i, file := range files {
-		if file.matchGroup != i {
+		if file.matchGroup != i && file.livePhoto != nil {
+			file.duplicateOf = files[file.matchGroup]
+		} else if file.matchGroup != i {
 			deleteFile(file.path)
 		} else {
 			Info("## \"%s\"\n", file.path)
@@ -0,0 +1,371 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// placeholderRE matches placeholders of directory and name formats, e.g.
+// {Model} or {Model|no camera} with the value used when the field is missing.
+var placeholderRE = regexp.MustCompile(`\{([^{}|]*)(?:\|([^{}]*))?\}`)
+
+// unknownPlaceholder replaces fields missing in file meta data, unless
+// placeholder gives its own default.
+const unknownPlaceholder = "unknown"
+
+// hashLength is the number of hex digits of {hash}.
+const hashLength = 8
+
+// fileFields are placeholders describing the file rather than its meta data.
+var fileFields = map[string]string{
+	"kind":  "photo or video",
+	"ext":   "original extension",
+	"name":  "original name without extension",
+	"dir":   "directory relative to source directory",
+	"hash":  "start of SHA-256 of contents",
+	"seq":   "sequence number within destination directory, in order of time",
+	"event": "number of the event, with --event-gap",
+}
+
+// metadataFields are placeholders for file meta data; names are as in
+// fileinfo.metadata, with short aliases.
+var metadataFields = map[string]string{
+	"make":             metadataMake,
+	"model":            metadataModel,
+	"lens":             metadataLens,
+	"lensmodel":        metadataLens,
+	"serial":           metadataSerial,
+	"bodyserialnumber": metadataSerial,
+	"description":      metadataDescription,
+	"rating":           metadataRating,
+	"keywords":         metadataKeywords,
+	"caption":          metadataCaption,
+	"headline":         metadataHeadline,
+	"byline":           metadataByline,
+	"city":             metadataCity,
+	"state":            metadataState,
+	"country":          metadataCountry,
+}
+
+// nameFormat is the format of new file names; empty keeps original names.
+var nameFormat string
+
+// directoryTemplate is parsed --dir-fmt.
+var directoryTemplate *pathTemplate
+
+// templateElement is a part of directory or name format: literal text, time
+// format or placeholder.
+type templateElement struct {
+	text     string // literal text
+	time     timeFormat
+	field    string // placeholder name, lower case
+	fallback string
+}
+
+// pathTemplate is parsed directory or name format.
+type pathTemplate struct {
+	elements []templateElement
+	// directory templates may produce subdirectories
+	directory bool
+}
+
+// parseTemplate parses directory or name format. Text outside placeholders
+// is time format in directory format, e.g. yyyy/mm, and literal text in name
+// format, where time is given with placeholders like {yyyy}.
+func parseTemplate(format string, directory bool) (*pathTemplate, error) {
+	template := &pathTemplate{directory: directory}
+	addText := func(text string) error {
+		if strings.ContainsAny(text, "{}") {
+			return fmt.Errorf("unmatched brace in '%s'", text)
+		}
+		if !directory && strings.ContainsAny(text, "/\\") {
+			return errors.New("name can not contain directories")
+		}
+		if text == "" {
+			return nil
+		}
+		element := templateElement{text: text}
+		if directory {
+			var err error
+			if element.time, err = parseTimeFormat(text); err != nil {
+				return err
+			}
+		}
+		template.elements = append(template.elements, element)
+		return nil
+	}
+
+	last := 0
+	for _, match := range placeholderRE.FindAllStringSubmatchIndex(format, -1) {
+		if err := addText(format[last:match[0]]); err != nil {
+			return nil, err
+		}
+		last = match[1]
+
+		name := format[match[2]:match[3]]
+		element := templateElement{field: strings.ToLower(name), fallback: unknownPlaceholder}
+		if match[4] >= 0 {
+			element.fallback = format[match[4]:match[5]]
+		}
+		switch _, isFileField := fileFields[element.field]; {
+		case element.field == "seq" && directory:
+			return nil, errors.New("{seq} can be used only in file names")
+		case isFileField:
+		case metadataFields[element.field] != "":
+		case isTimeFormat(name):
+			element = templateElement{}
+			element.time, _ = parseTimeFormat(name)
+		default:
+			return nil, fmt.Errorf("unknown placeholder {%s}; use yyyy etc. for time, or one of %s", name, availablePlaceholders())
+		}
+		template.elements = append(template.elements, element)
+	}
+	if err := addText(format[last:]); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// availablePlaceholders lists names of all placeholders, for error messages.
+func availablePlaceholders() string {
+	var names []string
+	for name := range fileFields {
+		names = append(names, name)
+	}
+	for name, key := range metadataFields {
+		if name == strings.ToLower(key) || len(name) < len(key) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// format returns path for the file taken at time t; seq is the number of the
+// file within its directory.
+func (this *pathTemplate) format(t time.Time, file *fileinfo, seq int) string {
+	var result strings.Builder
+	for _, element := range this.elements {
+		switch {
+		case element.time != nil:
+			result.WriteString(element.time.FormatLocale(t, directoryLocale))
+		case element.field == "":
+			result.WriteString(element.text)
+		default:
+			value := this.field(file, element.field, seq)
+			if value == "" {
+				value = element.fallback
+			}
+			result.WriteString(value)
+		}
+	}
+	return result.String()
+}
+
+// field returns value of the placeholder for the file, made safe for use in
+// path, or empty string if not known.
+func (this *pathTemplate) field(file *fileinfo, name string, seq int) string {
+	var value string
+	switch name {
+	case "kind":
+		value = "photo"
+		if isVideo(file.mediaType()) {
+			value = "video"
+		}
+	case "ext":
+		value = strings.TrimPrefix(filepath.Ext(file.path), ".")
+	case "name":
+		value = strings.TrimSuffix(filepath.Base(file.path), filepath.Ext(file.path))
+	case "dir":
+		if file.root != "" {
+			if rel, err := filepath.Rel(file.root, filepath.Dir(file.path)); err == nil && rel != "." {
+				value = filepath.ToSlash(rel)
+			}
+		}
+		if this.directory {
+			return value
+		}
+	case "hash":
+		value = file.contentHash()
+	case "event":
+		if file.event != nil {
+			value = fmt.Sprintf(eventIndexFormat, file.event.Index)
+		}
+	case "seq":
+		if seq > 0 {
+			value = fmt.Sprintf("%04d", seq)
+		}
+	default:
+		value = metadataField(file, metadataFields[name])
+		if value == "" {
+			value = geocodedField(file, metadataFields[name])
+		}
+	}
+	return strings.NewReplacer("/", "-", "\\", "-").Replace(value)
+}
+
+// initDirectoryTemplate parses --dir-fmt flag.
+func initDirectoryTemplate() error {
+	var err error
+	if directoryTemplate, err = parseTemplate(destinationDirectoryFormat, true); err != nil {
+		return fmt.Errorf("invalid --dir-fmt: %s", err)
+	}
+	return nil
+}
+
+// usesMetadataField returns true if the format has a placeholder of the meta
+// data field, e.g. {rating} for Rating.
+func usesMetadataField(format, key string) bool {
+	for _, match := range placeholderRE.FindAllStringSubmatch(format, -1) {
+		if metadataFields[strings.ToLower(match[1])] == key {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataField returns meta data field, ignoring case of the name, or empty
+// string if missing.
+func metadataField(file *fileinfo, name string) string {
+	for key, value := range file.metadata {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// contentHash returns start of SHA-256 of file contents, computed once.
+func (this *fileinfo) contentHash() string {
+	if this.hash == "" {
+		is, err := os.Open(this.path)
+		if err != nil {
+			return ""
+		}
+		defer is.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(hash, is); err != nil {
+			return ""
+		}
+		this.hash = hex.EncodeToString(hash.Sum(nil))[:hashLength]
+	}
+	return this.hash
+}
+
+// components splits directory template into templates of single path
+// components. Slashes in literal text of time formats, quoted or not, separate
+// components; placeholders are never split.
+func (this *pathTemplate) components() []*pathTemplate {
+	components := []*pathTemplate{{directory: this.directory}}
+	add := func(element templateElement) {
+		last := components[len(components)-1]
+		last.elements = append(last.elements, element)
+	}
+	for _, element := range this.elements {
+		if element.time == nil {
+			add(element)
+			continue
+		}
+		var format timeFormat
+		for _, part := range element.time {
+			if part.token != nil {
+				format = append(format, part)
+				continue
+			}
+			for i, literal := range strings.Split(part.literal, "/") {
+				if i > 0 {
+					if len(format) > 0 {
+						add(templateElement{time: format})
+						format = nil
+					}
+					components = append(components, &pathTemplate{directory: this.directory})
+				}
+				if literal != "" {
+					format = append(format, timeFormatElement{literal: literal})
+				}
+			}
+		}
+		if len(format) > 0 {
+			add(templateElement{time: format})
+		}
+	}
+	return components
+}
+
+// coarseDirectory formats leading components of the directory template which
+// are the same for the whole period of file time, e.g. only yyyy of yyyy/mm
+// for time known to a year precision. Returns empty string if even the first
+// component changes within the period.
+func coarseDirectory(template *pathTemplate, file *fileinfo) string {
+	end := file.precision.periodEnd(file.time)
+	var components []string
+	for _, component := range template.components() {
+		value := component.format(file.time, file, 0)
+		if value != component.format(end, file, 0) {
+			break
+		}
+		components = append(components, value)
+	}
+	return strings.Join(components, "/")
+}
+
+// applyNameFormat renames files with destination according to --name-fmt.
+// Files are numbered for {seq} in order of time within their directory.
+// Files whose time is not fully known keep their names.
+func applyNameFormat(files []*fileinfo) {
+	if nameFormat == "" {
+		return
+	}
+	template, err := parseTemplate(nameFormat, false)
+	if err != nil {
+		return
+	}
+
+	directories := make(map[string][]*fileinfo)
+	for _, file := range files {
+		if file.newPath != "" && file.isPrimary() {
+			directories[file.newDir] = append(directories[file.newDir], file)
+		}
+	}
+	for _, files := range directories {
+		sort.SliceStable(files, func(i, j int) bool {
+			if !files[i].time.Equal(files[j].time) {
+				return files[i].time.Before(files[j].time)
+			}
+			return files[i].path < files[j].path
+		})
+		seq := 0
+		for _, file := range files {
+			if file.precision != precisionFull {
+				Info("\r%s: keeping name, date/time known only to %s precision\n", file.path, file.precision)
+				continue
+			}
+			seq++
+			name := template.format(directoryTime(file.time), file, seq)
+			file.newPath = filepath.Join(file.newDir, name)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mustParseTemplate parses directory or name format, failing the test if it
+// is invalid.
+func mustParseTemplate(t *testing.T, format string, directory bool) *pathTemplate {
+	template, err := parseTemplate(format, directory)
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %s", format, err)
+	}
+	return template
+}
+
+// setDirectoryFormat sets and parses --dir-fmt.
+func setDirectoryFormat(t *testing.T, format string) {
+	destinationDirectoryFormat = format
+	if err := initDirectoryTemplate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		format    string
+		directory bool
+		err       string
+	}{
+		{"yyyy/{mm}/{Model|no camera}/{kind}", true, ""},
+		{"{dir}/{Lens}-{hash}", true, ""},
+		{"{yyyymmdd}_{HHMMSS}_{model}.{ext}", false, ""},
+		{"{name}-{seq}.{EXT}", false, ""},
+		{"yyyy/{seq}", true, "{seq} can be used only in file names"},
+		{"yyyy/{camera}", true, "unknown placeholder {camera}"},
+		{"yyyy/'Summer'/{ww}", true, ""},
+		{"yyyy/Summer", true, "unknown token 'S' at position 6 of 'yyyy/Summer'"},
+		{"{yyyy}-Summer.{ext}", false, ""},
+		{"{yyyy}/{name}.{ext}", false, "name can not contain directories"},
+		{"{name.{ext}", false, "unmatched brace in '{name.'"},
+		{"{name}}.{ext}", false, "unmatched brace in '}.'"},
+	}
+
+	for _, test := range tests {
+		_, err := parseTemplate(test.format, test.directory)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.format, err)
+		} else if test.err != "" && (err == nil || !strings.HasPrefix(err.Error(), test.err)) {
+			t.Errorf("%s: expected error:%s got:%v", test.format, test.err, err)
+		}
+	}
+}
+
+func TestApplyNameFormat(t *testing.T) {
+	defer func() { nameFormat = "" }()
+
+	dir, err := ioutil.TempDir("", "photo-cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "Trip"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Trip/IMG_0002.JPG", "Trip/IMG_0001.JPG", "Trip/MVI_0003.MOV", "DSC_0100.jpg"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mkFile := func(name string, t time.Time, precision timePrecision, metadata map[string]string) *fileinfo {
+		return &fileinfo{
+			path:      filepath.Join(dir, name),
+			root:      dir,
+			newDir:    "dest/2019",
+			newPath:   filepath.Join("dest/2019", filepath.Base(name)),
+			time:      t,
+			precision: precision,
+			metadata:  metadata,
+		}
+	}
+	base := time.Date(2019, 6, 7, 8, 9, 10, 0, time.UTC)
+	files := []*fileinfo{
+		mkFile("Trip/IMG_0002.JPG", base.Add(time.Minute), precisionFull, map[string]string{metadataModel: "EOS 80D"}),
+		mkFile("Trip/IMG_0001.JPG", base, precisionFull, map[string]string{metadataModel: "EOS 80D"}),
+		mkFile("Trip/MVI_0003.MOV", base.Add(2*time.Minute), precisionFull, nil),
+		mkFile("DSC_0100.jpg", base, precisionMonth, nil),
+		{path: filepath.Join(dir, "skipped.jpg")},
+	}
+
+	assumedZone = time.UTC
+	directoryZone = nil
+	defer func() { assumedZone = nil }()
+	nameFormat = "{yyyymmdd}_{HHMMSS}_{seq}_{model|phone}_{kind}_{dir}_{name}.{ext}"
+	applyNameFormat(files)
+
+	expected := []string{
+		"dest/2019/20190607_080910_0001_EOS 80D_photo_Trip_IMG_0001.JPG",
+		"dest/2019/20190607_081010_0002_EOS 80D_photo_Trip_IMG_0002.JPG",
+		"dest/2019/20190607_081110_0003_phone_video_Trip_MVI_0003.MOV",
+		"dest/2019/DSC_0100.jpg",
+		"",
+	}
+	for i, file := range []*fileinfo{files[1], files[0], files[2], files[3], files[4]} {
+		if file.newPath != expected[i] {
+			t.Errorf("%s: expected:%s got:%s", file.path, expected[i], file.newPath)
+		}
+	}
+
+	nameFormat = "{hash}.{ext}"
+	applyNameFormat(files[1:2])
+	if files[1].newPath != "dest/2019/0a62d8fc.JPG" {
+		t.Errorf("unexpected hash name: %s", files[1].newPath)
+	}
+	if got := mustParseTemplate(t, "{dir}/yyyy", true).format(base, files[0], 0); got != "Trip/2019" {
+		t.Errorf("unexpected directory: %s", got)
+	}
+}
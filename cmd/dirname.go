@@ -0,0 +1,125 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dates at the beginning of directory names, e.g. "2009-07-15 Birthday",
+// "2009-07 Croatia trip" or "2012". Years are limited to 19xx and 20xx to
+// avoid matching other numbers.
+var (
+	dirnameDayRE   = regexp.MustCompile(`^((?:19|20)[[:digit:]]{2})[-_. ]?(0[1-9]|1[0-2])[-_. ]?(0[1-9]|[12][[:digit:]]|3[01])(?:[^[:digit:]]|$)`)
+	dirnameMonthRE = regexp.MustCompile(`^((?:19|20)[[:digit:]]{2})[-_. ](0[1-9]|1[0-2])(?:[^[:digit:]]|$)`)
+	dirnameYearRE  = regexp.MustCompile(`^((?:19|20)[[:digit:]]{2})(?:[^[:digit:]]|$)`)
+	// month or day directory nested within year or month one, e.g. 2012/07
+	dirnameNestedRE = regexp.MustCompile(`^(0[1-9]|[12][[:digit:]]|3[01])(?:[^[:digit:]]|$)`)
+)
+
+// dirnameTimeSource parses dates from names of directories containing the
+// file, e.g. 2009-07 Croatia trip/scan.jpg or 2012/Christmas/scan.jpg. The
+// date of the directory nearest to the file wins. Time is the beginning of
+// the period named by the directory, with matching precision.
+type dirnameTimeSource struct{}
+
+func (dirnameTimeSource) Name() string {
+	return "dirname"
+}
+
+func (this dirnameTimeSource) Extract(file *fileinfo) (time.Time, confidence, error) {
+	candidates, err := this.Candidates(file)
+	if err != nil {
+		return time.Time{}, confidenceNone, err
+	}
+	return candidates[0].time, candidates[0].confidence, nil
+}
+
+// Candidates returns the date named by directories, with its precision.
+// Only directories below the source directory are considered, so that e.g.
+// /mnt/backup-2015/inbox does not date everything found in it.
+func (dirnameTimeSource) Candidates(file *fileinfo) ([]timeCandidate, error) {
+	dir := filepath.Dir(file.path)
+	if file.root != "" {
+		rel, err := filepath.Rel(file.root, dir)
+		if err != nil || rel == "." {
+			return nil, errNoTime
+		}
+		dir = rel
+	}
+	t, precision, ok := parseDirnameTime(dir)
+	if !ok {
+		return nil, errNoTime
+	}
+	return []timeCandidate{{
+		source:     "dirname",
+		time:       t,
+		precision:  precision,
+		confidence: confidenceLow,
+	}}, nil
+}
+
+// parseDirnameTime walks directory components from the root towards the file.
+// A dated component replaces any date found so far, while a plain month or
+// day component directly below it refines it.
+func parseDirnameTime(dir string) (time.Time, timePrecision, bool) {
+	var year, month, day int
+	var precision timePrecision
+	found := false
+	refinable := false
+
+	for _, name := range strings.Split(filepath.ToSlash(dir), "/") {
+		if match := dirnameDayRE.FindStringSubmatch(name); match != nil && validDate(atoi(match[1]), atoi(match[2]), atoi(match[3])) {
+			year, month, day = atoi(match[1]), atoi(match[2]), atoi(match[3])
+			precision = precisionDay
+		} else if match := dirnameMonthRE.FindStringSubmatch(name); match != nil {
+			year, month, day = atoi(match[1]), atoi(match[2]), 1
+			precision = precisionMonth
+		} else if match := dirnameYearRE.FindStringSubmatch(name); match != nil {
+			year, month, day = atoi(match[1]), 1, 1
+			precision = precisionYear
+		} else if match := dirnameNestedRE.FindStringSubmatch(name); match != nil && refinable && precision == precisionYear && atoi(match[1]) <= 12 {
+			month = atoi(match[1])
+			precision = precisionMonth
+		} else if match := dirnameNestedRE.FindStringSubmatch(name); match != nil && refinable && precision == precisionMonth && validDate(year, month, atoi(match[1])) {
+			day = atoi(match[1])
+			precision = precisionDay
+		} else {
+			refinable = false
+			continue
+		}
+		found = true
+		refinable = true
+	}
+
+	if !found {
+		return time.Time{}, precision, false
+	}
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, captureZone()), precision, true
+}
+
+// validDate returns false for dates like 2009-02-30.
+func validDate(year, month, day int) bool {
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Day() == day
+}
+
+func atoi(value string) int {
+	i, _ := strconv.Atoi(value)
+	return i
+}
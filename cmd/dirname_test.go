@@ -0,0 +1,150 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDirnameTime(t *testing.T) {
+	tests := []struct {
+		dir       string
+		expected  string
+		precision timePrecision
+	}{
+		{"/archive/2009-07 Croatia trip", "2009-07-01", precisionMonth},
+		{"/archive/2012/Christmas", "2012-01-01", precisionYear},
+		{"/archive/2012/07", "2012-07-01", precisionMonth},
+		{"/archive/2012/07/15", "2012-07-15", precisionDay},
+		{"/archive/2012/Trips/07", "2012-01-01", precisionYear},
+		{"/archive/2012/2009-07-15 Birthday", "2009-07-15", precisionDay},
+		{"/archive/20090715", "2009-07-15", precisionDay},
+		{"/archive/2009.07.15", "2009-07-15", precisionDay},
+		{"/archive/2009_07", "2009-07-01", precisionMonth},
+		{"/archive/2009-02-30", "2009-02-01", precisionMonth},
+		{"/archive/1999 scans/13", "1999-01-01", precisionYear},
+		{"/archive/Scans", "", precisionFull},
+		{"/archive/12345", "", precisionFull},
+		{"/archive/200907", "", precisionFull},
+	}
+
+	for _, test := range tests {
+		got, precision, ok := parseDirnameTime(test.dir)
+		if test.expected == "" {
+			if ok {
+				t.Errorf("%s: expected no date, got:%s", test.dir, got)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s: expected:%s got no date", test.dir, test.expected)
+			continue
+		}
+		if got.Format("2006-01-02") != test.expected || precision != test.precision {
+			t.Errorf("%s: expected:%s (%s) got:%s (%s)", test.dir, test.expected, test.precision, got.Format("2006-01-02"), precision)
+		}
+	}
+}
+
+func TestCoarseDirectory(t *testing.T) {
+	year := time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC)
+	month := time.Date(2012, 7, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		format    string
+		start     time.Time
+		precision timePrecision
+		expected  string
+	}{
+		{"yyyy/mm", year, precisionYear, "2012"},
+		{"yyyy/mm", month, precisionMonth, "2012/07"},
+		{"yyyy/mm/dd", month, precisionMonth, "2012/07"},
+		{"yyyy/mmm", month, precisionMonth, "2012/Jul"},
+		{"yyyy-mm/dd", year, precisionYear, ""},
+		{"yyyy/ddd", month, precisionDay, "2012/Sun"},
+		{"yyyy/ddd", month, precisionMonth, "2012"},
+		{"yyyy/'a/b' mm", year, precisionYear, "2012/a"},
+		{"yyyy/{dir|a/b}/mm", year, precisionYear, "2012/a/b"},
+	}
+
+	for _, test := range tests {
+		file := &fileinfo{time: test.start, precision: test.precision}
+		got := coarseDirectory(mustParseTemplate(t, test.format, true), file)
+		if got != test.expected {
+			t.Errorf("%s (%s): expected:%s got:%s", test.format, test.precision, test.expected, got)
+		}
+	}
+}
+
+func TestDirnameTimeSource(t *testing.T) {
+	defer func() {
+		useFileTime = false
+	}()
+
+	setDirectoryFormat(t, "yyyy/mm")
+	useFileTime = true
+
+	files := []*fileinfo{
+		mkFakeFile("/archive/2009-07 Croatia trip/scan001.jpg"),
+		mkFakeFile("/archive/2012/Christmas/scan002.jpg"),
+		mkFakeFile("/archive/2012/IMG_20120304_123456.jpg"),
+		mkFakeFile("/archive/Scans/scan003.jpg"),
+	}
+	files[3].info.(*fakeFileInfo).modTime = time.Date(2015, 5, 5, 12, 0, 0, 0, time.Local)
+	evaluate(files, "dest")
+
+	expected := []struct {
+		newPath string
+		source  string
+	}{
+		{"dest/2009/07/scan001.jpg", "dirname"},
+		{"dest/2012/scan002.jpg", "dirname"},
+		{"dest/2012/03/IMG_20120304_123456.jpg", "filename"},
+		{"dest/2015/05/scan003.jpg", "mtime"},
+	}
+	for i, file := range files {
+		if file.newPath != expected[i].newPath || file.timeSource != expected[i].source {
+			t.Errorf("%s: expected:%s from %s got:%s from %s", file.path, expected[i].newPath, expected[i].source, file.newPath, file.timeSource)
+		}
+	}
+}
+
+func TestDirnameTimeSourceBelowRoot(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/mnt/2015 backup/inbox/scan001.jpg", ""},
+		{"/mnt/2015 backup/inbox/2009-07 Croatia trip/scan001.jpg", "2009-07-01"},
+		{"/mnt/2015 backup/inbox/Croatia/2009/07/scan001.jpg", "2009-07-01"},
+	}
+
+	for _, test := range tests {
+		file := mkFakeFile(test.path)
+		file.root = "/mnt/2015 backup/inbox"
+		candidates, err := dirnameTimeSource{}.Candidates(file)
+		if test.expected == "" {
+			if err != errNoTime {
+				t.Errorf("%s: expected no time, got:%v (%v)", test.path, candidates, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.path, err)
+		} else if candidates[0].time.Format("2006-01-02") != test.expected {
+			t.Errorf("%s: expected:%s got:%s", test.path, test.expected, candidates[0].time)
+		}
+	}
+}
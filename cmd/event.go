@@ -0,0 +1,347 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// eventGap is the gap in time which starts a new event; zero disables
+// grouping into events.
+var eventGap time.Duration
+
+// eventDistance is the distance in kilometers between consecutive photos
+// which starts a new event; zero disables it.
+var eventDistance float64
+
+// eventFormat is the directory format of events, applied to the time the
+// event started.
+var eventFormat string
+
+// eventSummaryFile is JSON or CSV file listing all events.
+var eventSummaryFile string
+
+// eventIndexFormat formats {event} placeholder.
+const eventIndexFormat = "%03d"
+
+// earthRadius is the mean radius of Earth in kilometers.
+const earthRadius = 6371.0
+
+// photoEvent is a group of files taken close in time, and in space when
+// known.
+type photoEvent struct {
+	Index     int       `json:"index"`
+	Dir       string    `json:"dir"` // relative to destination directory
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Files     int       `json:"files"`
+	Latitude  *float64  `json:"latitude,omitempty"`
+	Longitude *float64  `json:"longitude,omitempty"`
+	// Name is filled in by the user and applied by rename-event
+	Name string `json:"name"`
+}
+
+// renameEventCmd represents the rename-event command
+var renameEventCmd = &cobra.Command{
+	Use:   "rename-event destdir summary",
+	Short: "Rename event directories using names from event summary.",
+	Long: `Rename event directories using names from event summary.
+
+organize with --event-gap and --event-summary writes the list of events it
+created into JSON or CSV summary. Fill in the names of the events in the
+summary, and rename-event renames their directories, replacing the event index
+with the name, e.g. 2018/2018-03-04 007 becomes 2018/2018-03-04 Zoo. The
+summary is updated with the new directories, and events without name or
+already renamed are left alone.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := renameEvents(args[0], args[1]); err != nil {
+			Print("Error: %s\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renameEventCmd)
+}
+
+// distance returns great-circle distance between two locations in
+// kilometers.
+func distance(a, b *geoLocation) float64 {
+	lat1 := a.latitude * math.Pi / 180
+	lat2 := b.latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLong := (b.longitude - a.longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// clusterEvents sorts files with known destination by time, and splits them
+// into events wherever the gap between consecutive files exceeds
+// --event-gap, or the distance from the last located file of the event
+// exceeds --event-distance. Files are moved into directories given by
+// --event-fmt for the start of their event. Files whose time is not fully
+// known stay in directories given by --dir-fmt.
+func clusterEvents(files []*fileinfo, dest string) []*photoEvent {
+	if eventGap <= 0 {
+		return nil
+	}
+	template, err := parseTemplate(eventFormat, true)
+	if err != nil {
+		return nil
+	}
+
+	var dated []*fileinfo
+	for _, file := range files {
+		if file.newPath != "" && file.precision == precisionFull {
+			dated = append(dated, file)
+		}
+	}
+	sort.SliceStable(dated, func(i, j int) bool {
+		if !dated[i].time.Equal(dated[j].time) {
+			return dated[i].time.Before(dated[j].time)
+		}
+		return dated[i].path < dated[j].path
+	})
+
+	var events []*photoEvent
+	var event *photoEvent
+	var members []*fileinfo
+	var location *geoLocation
+	finish := func() {
+		if event != nil {
+			event.finish(members, template, dest)
+		}
+	}
+	for _, file := range dated {
+		split := event == nil || file.time.Sub(members[len(members)-1].time) > eventGap
+		if !split && eventDistance > 0 && location != nil && file.location != nil {
+			split = distance(location, file.location) > eventDistance
+		}
+		if split {
+			finish()
+			event = &photoEvent{Index: len(events) + 1, Start: directoryTime(file.time)}
+			events = append(events, event)
+			members = nil
+			location = nil
+		}
+		members = append(members, file)
+		if file.location != nil {
+			location = file.location
+		}
+	}
+	finish()
+	return events
+}
+
+// finish records the files of the event, their time span and average
+// location, and sets their destination.
+func (this *photoEvent) finish(files []*fileinfo, template *pathTemplate, dest string) {
+	this.Files = len(files)
+	this.End = directoryTime(files[len(files)-1].time)
+
+	var latitude, longitude float64
+	located := 0
+	for _, file := range files {
+		file.event = this
+		if file.location != nil {
+			latitude += file.location.latitude
+			longitude += file.location.longitude
+			located++
+		}
+		file.newDir = filepath.Join(dest, template.format(this.Start, file, 0))
+		file.newPath = filepath.Join(file.newDir, filepath.Base(file.newPath))
+	}
+	if located > 0 {
+		latitude /= float64(located)
+		longitude /= float64(located)
+		this.Latitude = &latitude
+		this.Longitude = &longitude
+	}
+	if dir, err := filepath.Rel(dest, files[0].newDir); err == nil {
+		this.Dir = filepath.ToSlash(dir)
+	}
+	Info("\rEvent %d: %s - %s, %d files in %s\n", this.Index, this.Start.Format("2006-01-02 15:04"), this.End.Format("2006-01-02 15:04"), this.Files, this.Dir)
+}
+
+// eventSummaryHeader are columns of CSV summary.
+var eventSummaryHeader = []string{"index", "dir", "start", "end", "files", "latitude", "longitude", "name"}
+
+// writeEventSummary writes events into JSON file, or CSV file when its
+// extension is .csv.
+func writeEventSummary(path string, events []*photoEvent) error {
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		var result strings.Builder
+		w := csv.NewWriter(&result)
+		w.Write(eventSummaryHeader)
+		for _, event := range events {
+			var latitude, longitude string
+			if event.Latitude != nil && event.Longitude != nil {
+				latitude = strconv.FormatFloat(*event.Latitude, 'f', 6, 64)
+				longitude = strconv.FormatFloat(*event.Longitude, 'f', 6, 64)
+			}
+			w.Write([]string{
+				strconv.Itoa(event.Index),
+				event.Dir,
+				event.Start.Format(time.RFC3339),
+				event.End.Format(time.RFC3339),
+				strconv.Itoa(event.Files),
+				latitude,
+				longitude,
+				event.Name,
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		data = []byte(result.String())
+	} else {
+		var err error
+		if data, err = json.MarshalIndent(events, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// readEventSummary reads events written by writeEventSummary.
+func readEventSummary(path string) ([]*photoEvent, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var events []*photoEvent
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		if err := json.Unmarshal(data, &events); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		return events, nil
+	}
+
+	r := csv.NewReader(strings.NewReader(string(data)))
+	r.FieldsPerRecord = len(eventSummaryHeader)
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	for i, record := range records {
+		if i == 0 && record[0] == eventSummaryHeader[0] {
+			continue
+		}
+		event := &photoEvent{Dir: record[1], Name: record[7]}
+		if event.Index, err = strconv.Atoi(record[0]); err != nil {
+			return nil, fmt.Errorf("%s: line %d: invalid index '%s'", path, i+1, record[0])
+		}
+		// the rest is informative only
+		event.Start, _ = time.Parse(time.RFC3339, record[2])
+		event.End, _ = time.Parse(time.RFC3339, record[3])
+		event.Files, _ = strconv.Atoi(record[4])
+		if latitude, err := strconv.ParseFloat(record[5], 64); err == nil {
+			event.Latitude = &latitude
+		}
+		if longitude, err := strconv.ParseFloat(record[6], 64); err == nil {
+			event.Longitude = &longitude
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// namedEventDir returns directory of the event with its index replaced with
+// the name, or empty string if the event has no name or its directory does
+// not contain the index, i.e. it was already renamed.
+func namedEventDir(event *photoEvent) string {
+	name := strings.NewReplacer("/", "-", "\\", "-").Replace(strings.TrimSpace(event.Name))
+	index := fmt.Sprintf(eventIndexFormat, event.Index)
+	dir, base := filepath.Split(filepath.FromSlash(event.Dir))
+	i := eventIndexOffset(base, index)
+	if name == "" || i < 0 {
+		return ""
+	}
+	return filepath.Join(dir, base[:i]+name+base[i+len(index):])
+}
+
+// eventIndexOffset returns offset of the last occurrence of the formatted
+// event index in the directory name which is not adjacent to other digits,
+// so that e.g. 015 of year 2015 is not taken for event 15; -1 if there is
+// none.
+func eventIndexOffset(base, index string) int {
+	isDigit := func(i int) bool {
+		return i >= 0 && i < len(base) && base[i] >= '0' && base[i] <= '9'
+	}
+	for i := strings.LastIndex(base, index); i >= 0; i = strings.LastIndex(base[:i], index) {
+		if !isDigit(i-1) && !isDigit(i+len(index)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// renameEvents renames directories of named events from the summary and
+// records new directories in the summary.
+func renameEvents(dest, summary string) error {
+	events, err := readEventSummary(summary)
+	if err != nil {
+		return err
+	}
+
+	renamed := 0
+	for _, event := range events {
+		newDir := namedEventDir(event)
+		if newDir == "" {
+			continue
+		}
+		oldpath := filepath.Join(dest, filepath.FromSlash(event.Dir))
+		newpath := filepath.Join(dest, newDir)
+		if _, err := os.Stat(oldpath); err != nil {
+			Print("%s: skipped, %s\n", oldpath, err)
+			continue
+		}
+		if _, err := os.Stat(newpath); err == nil {
+			Print("%s: skipped, %s already exists\n", oldpath, newpath)
+			continue
+		}
+		Print("mv %s %s\n", oldpath, newpath)
+		if dryRun {
+			continue
+		}
+		if err := OS.Rename(oldpath, newpath); err != nil {
+			Print("%s: failed to rename: %s\n", oldpath, err)
+			continue
+		}
+		event.Dir = filepath.ToSlash(newDir)
+		renamed++
+	}
+
+	if renamed == 0 {
+		return nil
+	}
+	return writeEventSummary(summary, events)
+}
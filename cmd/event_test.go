@@ -0,0 +1,218 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDistance(t *testing.T) {
+	belgrade := &geoLocation{44.8125, 20.4612}
+	zagreb := &geoLocation{45.8150, 15.9819}
+	if got := distance(belgrade, zagreb); math.Abs(got-368) > 5 {
+		t.Errorf("unexpected distance: %f", got)
+	}
+	if got := distance(belgrade, belgrade); got != 0 {
+		t.Errorf("unexpected distance: %f", got)
+	}
+}
+
+func TestClusterEvents(t *testing.T) {
+	defer func() {
+		eventGap = 0
+		eventDistance = 0
+	}()
+	eventGap = 6 * time.Hour
+	eventDistance = 50
+	eventFormat = "yyyy/yyyy-mm-dd {event}"
+
+	base := time.Date(2018, 3, 4, 10, 0, 0, 0, time.UTC)
+	belgrade := &geoLocation{44.8125, 20.4612}
+	novisad := &geoLocation{45.2671, 19.8335}
+	mkFile := func(name string, offset time.Duration, location *geoLocation) *fileinfo {
+		return &fileinfo{
+			path:     "/src/" + name,
+			newDir:   "/dest/2018/03",
+			newPath:  "/dest/2018/03/" + name,
+			time:     base.Add(offset),
+			location: location,
+		}
+	}
+	files := []*fileinfo{
+		mkFile("IMG_0003.JPG", 2*time.Hour, nil),
+		mkFile("IMG_0001.JPG", 0, belgrade),
+		mkFile("IMG_0002.JPG", time.Hour, nil),
+		// next day, after a gap
+		mkFile("IMG_0004.JPG", 26*time.Hour, belgrade),
+		// an hour later, but far away
+		mkFile("IMG_0005.JPG", 27*time.Hour, novisad),
+		mkFile("IMG_0006.JPG", 28*time.Hour, nil),
+		// no time, stays where it is
+		{path: "/src/IMG_0007.JPG"},
+		// known only to a year
+		{path: "/src/2017/IMG_0008.JPG", newDir: "/dest/2017", newPath: "/dest/2017/IMG_0008.JPG", time: base, precision: precisionYear},
+	}
+
+	events := clusterEvents(files, "/dest")
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	expected := []struct {
+		dir   string
+		files int
+		start time.Time
+	}{
+		{"2018/2018-03-04 001", 3, base},
+		{"2018/2018-03-05 002", 1, base.Add(26 * time.Hour)},
+		{"2018/2018-03-05 003", 2, base.Add(27 * time.Hour)},
+	}
+	for i, test := range expected {
+		if events[i].Dir != test.dir || events[i].Files != test.files || !events[i].Start.Equal(test.start) {
+			t.Errorf("event %d: unexpected %+v", i+1, events[i])
+		}
+	}
+	if events[0].Latitude == nil || *events[0].Latitude != belgrade.latitude {
+		t.Errorf("unexpected location of event 1")
+	}
+	if events[1].Latitude != nil && *events[1].Latitude != belgrade.latitude {
+		t.Errorf("unexpected location of event 2")
+	}
+
+	paths := map[string]string{
+		"/src/IMG_0001.JPG":      "/dest/2018/2018-03-04 001/IMG_0001.JPG",
+		"/src/IMG_0003.JPG":      "/dest/2018/2018-03-04 001/IMG_0003.JPG",
+		"/src/IMG_0006.JPG":      "/dest/2018/2018-03-05 003/IMG_0006.JPG",
+		"/src/IMG_0007.JPG":      "",
+		"/src/2017/IMG_0008.JPG": "/dest/2017/IMG_0008.JPG",
+	}
+	for _, file := range files {
+		if expected, ok := paths[file.path]; ok && file.newPath != expected {
+			t.Errorf("%s: expected:%s got:%s", file.path, expected, file.newPath)
+		}
+	}
+}
+
+func TestNamedEventDir(t *testing.T) {
+	tests := []struct {
+		index    int
+		dir      string
+		expected string
+	}{
+		{7, "2018/2018-03-04 007", "2018/2018-03-04 Zoo"},
+		{15, "2015/015 2015-06-01", "2015/Zoo 2015-06-01"},
+		{1, "2001/001 2001-01-01", "2001/Zoo 2001-01-01"},
+		{15, "2015/2015-01-15", ""},
+		{7, "2018/2018-03-04 Zoo", ""},
+	}
+	for _, test := range tests {
+		event := &photoEvent{Index: test.index, Dir: test.dir, Name: "Zoo"}
+		if got := filepath.ToSlash(namedEventDir(event)); got != test.expected {
+			t.Errorf("%s: expected:%s got:%s", test.dir, test.expected, got)
+		}
+	}
+}
+
+func TestRenameEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "photo-cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "dest")
+
+	start := time.Date(2018, 3, 4, 10, 0, 0, 0, time.UTC)
+	latitude, longitude := 44.8125, 20.4612
+	events := []*photoEvent{
+		{Index: 1, Dir: "2018/2018-03-04 001", Start: start, End: start.Add(time.Hour), Files: 3, Latitude: &latitude, Longitude: &longitude},
+		{Index: 2, Dir: "2018/2018-03-05 002", Start: start.Add(24 * time.Hour), End: start.Add(25 * time.Hour), Files: 1},
+		{Index: 3, Dir: "2018/2018-03-06 003", Start: start.Add(48 * time.Hour), End: start.Add(48 * time.Hour), Files: 1},
+	}
+	for _, event := range events {
+		if err := os.MkdirAll(filepath.Join(dest, event.Dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, summary := range []string{"events.json", "events.csv"} {
+		path := filepath.Join(dir, summary)
+		if err := writeEventSummary(path, events); err != nil {
+			t.Fatal(err)
+		}
+		read, err := readEventSummary(path)
+		if err != nil {
+			t.Fatalf("%s: %s", summary, err)
+		}
+		if len(read) != len(events) {
+			t.Fatalf("%s: expected %d events, got %d", summary, len(events), len(read))
+		}
+		for i, event := range read {
+			if event.Index != events[i].Index || event.Dir != events[i].Dir || !event.Start.Equal(events[i].Start) || event.Files != events[i].Files {
+				t.Errorf("%s: event %d: unexpected %+v", summary, i+1, event)
+			}
+		}
+		if read[0].Latitude == nil || *read[0].Latitude != latitude || read[1].Latitude != nil {
+			t.Errorf("%s: unexpected location", summary)
+		}
+	}
+
+	// name the first two events in CSV summary
+	events[0].Name = "Zoo"
+	events[1].Name = "Novi Sad/Petrovaradin"
+	summary := filepath.Join(dir, "events.csv")
+	if err := writeEventSummary(summary, events); err != nil {
+		t.Fatal(err)
+	}
+
+	dryRun = true
+	InitProdOs()
+	if err := renameEvents(dest, summary); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "2018/2018-03-04 001")); err != nil {
+		t.Errorf("dry run renamed directory: %s", err)
+	}
+
+	dryRun = false
+	if err := renameEvents(dest, summary); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"2018/2018-03-04 Zoo", "2018/2018-03-05 Novi Sad-Petrovaradin", "2018/2018-03-06 003"} {
+		if _, err := os.Stat(filepath.Join(dest, expected)); err != nil {
+			t.Errorf("%s: %s", expected, err)
+		}
+	}
+	read, err := readEventSummary(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read[0].Dir != "2018/2018-03-04 Zoo" || read[2].Dir != "2018/2018-03-06 003" {
+		t.Errorf("summary not updated: %s, %s", read[0].Dir, read[2].Dir)
+	}
+
+	// running again changes nothing
+	if err := renameEvents(dest, summary); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"2018/2018-03-04 Zoo", "2018/2018-03-05 Novi Sad-Petrovaradin"} {
+		if _, err := os.Stat(filepath.Join(dest, expected)); err != nil {
+			t.Errorf("renamed again: %s", err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xor-gate/goexif2/exif"
+	"github.com/xor-gate/goexif2/tiff"
+)
+
+// Exif 2.31 fields not known to goexif2.
+const (
+	exifOffsetTime          exif.FieldName = "OffsetTime"
+	exifOffsetTimeOriginal  exif.FieldName = "OffsetTimeOriginal"
+	exifOffsetTimeDigitized exif.FieldName = "OffsetTimeDigitized"
+	exifBodySerialNumber    exif.FieldName = "BodySerialNumber"
+)
+
+// extraExifFields are loaded from Exif IFD in addition to those goexif2
+// loads itself.
+var extraExifFields = map[uint16]exif.FieldName{
+	0x9010: exifOffsetTime,
+	0x9011: exifOffsetTimeOriginal,
+	0x9012: exifOffsetTimeDigitized,
+	0xa431: exifBodySerialNumber,
+}
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// decodeExif reads exif meta data from the file, locating it according to
+// the file type.
+func decodeExif(is *os.File, file *fileinfo) (*exif.Exif, error) {
+	ext := file.mediaType()
+	if heifFileTypes[ext] {
+		data, err := decodeHeifExif(is, file.info.Size())
+		if err != nil {
+			return nil, err
+		}
+		return decodeTiffExif(bytes.NewReader(data))
+	}
+	if rawFileTypes[ext] {
+		return decodeRawExif(is, file.info.Size())
+	}
+
+	r, err := jpegExifReader(is)
+	if err != nil {
+		// not a well formed jpeg; let goexif2 search for exif on its own
+		if _, err := is.Seek(0, 0); err != nil {
+			return nil, err
+		}
+		return exif.Decode(is)
+	}
+	return decodeTiffExif(r)
+}
+
+// decodeTiffExif decodes exif from reader positioned at TIFF header and
+// loads fields goexif2 does not know about.
+func decodeTiffExif(r tiff.ReadAtReaderSeeker) (*exif.Exif, error) {
+	x, err := exif.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	loadExtraExifFields(x, r, extraExifFields)
+	return x, nil
+}
+
+// loadExtraExifFields decodes Exif IFD once more and loads fields from the
+// given map. Errors are ignored as all standard fields are already loaded.
+func loadExtraExifFields(x *exif.Exif, r tiff.ReadAtReaderSeeker, fields map[uint16]exif.FieldName) {
+	tag, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return
+	}
+	offset, err := tag.Int64(0)
+	if err != nil {
+		return
+	}
+	if _, err := r.Seek(offset, 0); err != nil {
+		return
+	}
+	dir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return
+	}
+	x.LoadTags(dir, fields, false)
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) (string, error) {
+	tag, err := x.Get(name)
+	if err != nil {
+		return "", err
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimRight(value, "\x00")), nil
+}
+
+// exifWallTime returns time from the first present field, as wall clock
+// time without zone information, i.e. in UTC.
+func exifWallTime(x *exif.Exif, names ...exif.FieldName) (time.Time, exif.FieldName, error) {
+	var lastErr error = exif.TagNotPresentError(names[0])
+	for _, name := range names {
+		value, err := exifString(x, name)
+		if err != nil {
+			continue
+		}
+		t, err := time.Parse(exifTimeLayout, value)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return t, name, nil
+	}
+	return time.Time{}, "", lastErr
+}
+
+// exifGPSTime returns UTC time of the GPS fix.
+func exifGPSTime(x *exif.Exif) (time.Time, error) {
+	date, err := exifString(x, exif.GPSDateStamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	day, err := time.Parse("2006:01:02", date)
+	if err != nil {
+		return time.Time{}, err
+	}
+	tag, err := x.Get(exif.GPSTimeStamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if tag.Count < 3 {
+		return time.Time{}, errors.New("invalid GPSTimeStamp")
+	}
+	var parts [3]float64
+	for i := range parts {
+		num, den, err := tag.Rat2(i)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if den == 0 {
+			return time.Time{}, errors.New("invalid GPSTimeStamp")
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+	seconds := parts[0]*3600 + parts[1]*60 + parts[2]
+	return day.Add(time.Duration(seconds * float64(time.Second))), nil
+}
+
+// exifTimeFields lists exif time fields in order of preference, each with
+// the field holding its offset from UTC.
+var exifTimeFields = []struct {
+	time   exif.FieldName
+	offset exif.FieldName
+}{
+	{exif.DateTimeOriginal, exifOffsetTimeOriginal},
+	{exif.DateTimeDigitized, exifOffsetTimeDigitized},
+	{exif.DateTime, exifOffsetTime},
+}
+
+// metadataTime is a time read from file meta data and the field holding it.
+type metadataTime struct {
+	field string
+	time  time.Time
+}
+
+// exifCaptureTimes returns times from all exif time fields present, in the
+// zone the photo was taken in when known. If there are none, GPS time is
+// returned.
+func exifCaptureTimes(x *exif.Exif) []metadataTime {
+	var times []metadataTime
+	for _, field := range exifTimeFields {
+		wall, _, err := exifWallTime(x, field.time)
+		if err != nil {
+			continue
+		}
+		times = append(times, metadataTime{
+			field: string(field.time),
+			time:  wallTimeIn(wall, exifZone(x, wall, field.offset)),
+		})
+	}
+	if len(times) > 0 {
+		return times
+	}
+
+	if gpsTime, err := exifGPSTime(x); err == nil {
+		if assumedZone != nil {
+			gpsTime = gpsTime.In(assumedZone)
+		} else if long, ok := exifLongitude(x); ok {
+			gpsTime = gpsTime.In(zoneFromLongitude(long))
+		}
+		times = append(times, metadataTime{field: string(exif.GPSDateStamp), time: gpsTime})
+	}
+	return times
+}
+
+// exifLongitude returns GPS longitude, unless position is missing or
+// obviously unset.
+func exifLongitude(x *exif.Exif) (float64, bool) {
+	location, ok := exifLocation(x)
+	if !ok {
+		return 0, false
+	}
+	return location.longitude, true
+}
+
+// exifLocation returns GPS position, unless missing or obviously unset.
+func exifLocation(x *exif.Exif) (*geoLocation, bool) {
+	lat, long, err := x.LatLong()
+	if err != nil || (lat == 0 && long == 0) {
+		return nil, false
+	}
+	return &geoLocation{latitude: lat, longitude: long}, true
+}
+
+// exifZone returns the zone of wall time read from exif. The zone is
+// determined from, in order:
+//   - offsetField or OffsetTime field (exif 2.31),
+//   - difference between the time and GPS time, if consistent with GPS
+//     position,
+//   - the zone given with --assume-tz,
+//   - the zone estimated from GPS position, which may be an hour or two off
+//     the legal time, or local zone.
+func exifZone(x *exif.Exif, wall time.Time, offsetField exif.FieldName) *time.Location {
+	for _, name := range []exif.FieldName{offsetField, exifOffsetTime} {
+		if value, err := exifString(x, name); err == nil {
+			if zone, err := parseZone(value); err == nil {
+				return zone
+			}
+		}
+	}
+
+	long, hasPosition := exifLongitude(x)
+	if gpsTime, err := exifGPSTime(x); err == nil {
+		offset := wall.Sub(gpsTime).Round(15 * time.Minute)
+		plausible := offset >= -14*time.Hour && offset <= 14*time.Hour
+		if plausible && hasPosition {
+			estimate := time.Duration(longitudeOffset(long)) * time.Second
+			difference := offset - estimate
+			plausible = difference >= -3*time.Hour && difference <= 3*time.Hour
+		}
+		if plausible {
+			return time.FixedZone("", int(offset/time.Second))
+		}
+	}
+	if assumedZone != nil {
+		return assumedZone
+	}
+	if hasPosition {
+		return zoneFromLongitude(long)
+	}
+	if zone, _ := x.TimeZone(); zone != nil {
+		return zone
+	}
+	return captureZone()
+}
+
+// exifMetadata returns fields identifying the camera and lens which took the
+// photo, and the Live Photo it belongs to.
+func exifMetadata(x *exif.Exif) map[string]string {
+	metadata := make(map[string]string)
+	fields := map[string]exif.FieldName{
+		metadataMake:   exif.Make,
+		metadataModel:  exif.Model,
+		metadataSerial: exifBodySerialNumber,
+		metadataLens:   exif.LensModel,
+	}
+	for key, name := range fields {
+		if value, err := exifString(x, name); err == nil && value != "" {
+			metadata[key] = value
+		}
+	}
+	if tag, err := x.Get(exif.MakerNote); err == nil {
+		if value, ok := appleMakerNoteString(tag.Val, appleContentIdentifierTag); ok {
+			metadata[metadataContentIdentifier] = value
+		}
+	}
+	return metadata
+}
@@ -0,0 +1,293 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// filenamePattern extracts time from file names matching re. The part of the
+// name captured by the group named "time" is parsed using layout given in
+// TimeFormat notation.
+type filenamePattern struct {
+	re    *regexp.Regexp
+	index int // index of the time group
+	// layouts are Go layouts of the pattern, and of the pattern with day and
+	// month swapped
+	layouts [2]string
+	// ambiguous patterns have day and month in front of the year, e.g.
+	// dd-mm-yyyy, and are also tried with the two swapped, i.e. mm-dd-yyyy
+	ambiguous bool
+	// precision is coarser than full for layouts without time of day, e.g.
+	// day for yyyymmdd
+	precision timePrecision
+}
+
+// builtinFilenamePatterns covers naming schemes of common phones, cameras,
+// messaging apps and scanners. They are tried in order after user supplied
+// patterns.
+var builtinFilenamePatterns = []struct {
+	expr   string
+	layout string
+}{
+	// Android camera, panorama, burst; IMG_20180304_123456.jpg
+	{`^(?i:IMG|VID|PANO|MVIMG|BURST[[:digit:]]*(?:_COVER)?)_(?P<time>[[:digit:]]{8}_[[:digit:]]{6})`, "yyyymmdd_HHMMSS"},
+	// Google Pixel; PXL_20200101_123456789.jpg
+	{`^(?i:PXL)_(?P<time>[[:digit:]]{8}_[[:digit:]]{6})[[:digit:]]{3}`, "yyyymmdd_HHMMSS"},
+	// Samsung; 20180304_123456.jpg, 20180304_123456(0).jpg
+	{`^(?P<time>[[:digit:]]{8}_[[:digit:]]{6})(?:[^[:digit:]]|$)`, "yyyymmdd_HHMMSS"},
+	// Dropbox camera uploads; 2018-03-04 12.34.56.jpg
+	{`^(?P<time>[[:digit:]]{4}-[[:digit:]]{2}-[[:digit:]]{2} [[:digit:]]{2}\.[[:digit:]]{2}\.[[:digit:]]{2})`, "yyyy-mm-dd HH.MM.SS"},
+	// WhatsApp; IMG-20180304-WA0001.jpg
+	{`^(?i:IMG|VID|AUD|PTT)-(?P<time>[[:digit:]]{8})-(?i:WA)[[:digit:]]+`, "yyyymmdd"},
+	// Android screenshots; Screenshot_20180304-123456.png
+	{`^(?i:Screenshot)_(?P<time>[[:digit:]]{8}-[[:digit:]]{6})`, "yyyymmdd-HHMMSS"},
+	// Android screenshots; Screenshot_2018-03-04-12-34-56.png
+	{`^(?i:Screenshot)_(?P<time>[[:digit:]]{4}(?:-[[:digit:]]{2}){5})`, "yyyy-mm-dd-HH-MM-SS"},
+	// macOS screenshots; Screen Shot 2018-03-04 at 12.34.56.png
+	{`^(?i:Screen ?shot) (?P<time>[[:digit:]]{4}-[[:digit:]]{2}-[[:digit:]]{2} at [[:digit:]]{2}\.[[:digit:]]{2}\.[[:digit:]]{2})(?:\.[^.]*)?$`, "yyyy-mm-dd 'at' HH.MM.SS"},
+	// macOS screenshots with 12-hour clock; Screen Shot 2018-03-04 at 1.34.56 PM.png
+	{`^(?i:Screen ?shot) (?P<time>[[:digit:]]{4}-[[:digit:]]{2}-[[:digit:]]{2} at [[:digit:]]{1,2}\.[[:digit:]]{2}\.[[:digit:]]{2} [AP]M)`, "yyyy-mm-dd 'at' h.MM.SS tt"},
+	// other macOS screenshots, e.g. with narrow space before PM; date only
+	{`^(?i:Screen ?shot) (?P<time>[[:digit:]]{4}-[[:digit:]]{2}-[[:digit:]]{2}) at `, "yyyy-mm-dd"},
+	// scanners; Scan 04-03-2018.jpg, scan_04.03.2018.jpg
+	{`^(?i:scan)[ _-]*(?P<time>[[:digit:]]{2}-[[:digit:]]{2}-[[:digit:]]{4})`, "dd-mm-yyyy"},
+	{`^(?i:scan)[ _-]*(?P<time>[[:digit:]]{2}\.[[:digit:]]{2}\.[[:digit:]]{4})`, "dd.mm.yyyy"},
+	// any name starting with ISO date; 2018-03-04 Birthday.jpg
+	{`^(?P<time>[[:digit:]]{4}-[[:digit:]]{2}-[[:digit:]]{2})(?:[^[:digit:]]|$)`, "yyyy-mm-dd"},
+}
+
+// userFilenamePatterns holds patterns given with --filename-pattern in
+// layout=regex form.
+var userFilenamePatterns []string
+
+var filenamePatterns = mustCompileFilenamePatterns(nil)
+
+// timeOfDayTokens are tokens giving time more precise than a day.
+var timeOfDayTokens = map[string]bool{
+	"HHT": true, "HH": true, "H": true, "hh": true, "h": true, "MM": true, "SS": true, "ss": true,
+}
+
+// dayMonthSwaps map day tokens onto month ones and vice versa.
+var dayMonthSwaps = map[string]string{"dd": "mm", "mm": "dd", "d": "m", "m": "d"}
+
+// newFilenamePattern compiles regular expression and checks that it has the
+// group with time.
+func newFilenamePattern(expr, layout string) (*filenamePattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename pattern '%s': %s", expr, err)
+	}
+	index := -1
+	for i, name := range re.SubexpNames() {
+		if name == "time" {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("filename pattern '%s' has no (?P<time>...) group", expr)
+	}
+	if layout == "" {
+		return nil, fmt.Errorf("filename pattern '%s' has no layout", expr)
+	}
+
+	format, err := parseTimeFormat(layout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid layout of filename pattern '%s': %s", expr, err)
+	}
+	pattern := &filenamePattern{re: re, index: index}
+	if pattern.layouts[0], err = format.layout(); err != nil {
+		return nil, fmt.Errorf("invalid layout of filename pattern '%s': %s", expr, err)
+	}
+
+	year, day, month := -1, -1, -1
+	timeOfDay := false
+	swapped := make(timeFormat, len(format))
+	for i, element := range format {
+		swapped[i] = element
+		if element.token == nil {
+			continue
+		}
+		if timeOfDayTokens[element.token.name] {
+			timeOfDay = true
+		}
+		switch name := element.token.name; {
+		case (name == "yyyy" || name == "yy") && year < 0:
+			year = i
+		case (name == "dd" || name == "d") && day < 0:
+			day = i
+		case (name == "mm" || name == "m") && month < 0:
+			month = i
+		}
+		if swap, ok := dayMonthSwaps[element.token.name]; ok {
+			swapped[i].token = findTimeToken(swap)
+		}
+	}
+	switch {
+	case timeOfDay:
+		pattern.precision = precisionFull
+	case day >= 0:
+		pattern.precision = precisionDay
+	case month >= 0:
+		pattern.precision = precisionMonth
+	default:
+		pattern.precision = precisionYear
+	}
+	pattern.ambiguous = day >= 0 && month >= 0 && (year < 0 || (day < year && month < year))
+	if pattern.ambiguous {
+		pattern.layouts[1], _ = swapped.layout()
+	}
+	return pattern, nil
+}
+
+// compileFilenamePatterns returns user supplied patterns, each in
+// layout=regex form, followed by built-in ones.
+func compileFilenamePatterns(user []string) ([]*filenamePattern, error) {
+	patterns := make([]*filenamePattern, 0, len(user)+len(builtinFilenamePatterns))
+	for _, value := range user {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("filename pattern '%s' is not in layout=regex form", value)
+		}
+		pattern, err := newFilenamePattern(parts[1], parts[0])
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	for _, builtin := range builtinFilenamePatterns {
+		pattern, err := newFilenamePattern(builtin.expr, builtin.layout)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func mustCompileFilenamePatterns(user []string) []*filenamePattern {
+	patterns, err := compileFilenamePatterns(user)
+	if err != nil {
+		panic(err)
+	}
+	return patterns
+}
+
+// match returns the part of the name holding time, or false if the name
+// does not match the pattern.
+func (this *filenamePattern) match(name string) (string, bool) {
+	match := this.re.FindStringSubmatch(name)
+	if match == nil {
+		return "", false
+	}
+	return match[this.index], true
+}
+
+// parse parses value using the layout, or the layout with day and month
+// swapped when swapped is set on ambiguous pattern. File names carry no zone,
+// so the time is assumed to be in the capture zone.
+func (this *filenamePattern) parse(value string, swapped bool) (time.Time, error) {
+	layout := this.layouts[0]
+	if this.ambiguous && swapped {
+		layout = this.layouts[1]
+	}
+	return time.ParseInLocation(layout, value, captureZone())
+}
+
+func findFilenamePattern(name string) (*filenamePattern, string) {
+	for _, pattern := range filenamePatterns {
+		if value, ok := pattern.match(name); ok {
+			return pattern, value
+		}
+	}
+	return nil, ""
+}
+
+// filenameTimeSource parses time encoded in file names by phones, cameras,
+// messaging apps and scanners.
+type filenameTimeSource struct {
+	// swapped records directories in which ambiguous names were found to
+	// have day and month in the order opposite of the pattern layout
+	swapped map[string]bool
+}
+
+func (this *filenameTimeSource) Name() string {
+	return "filename"
+}
+
+// Prepare decides for each directory whether ambiguous names have day or
+// month first. Names which parse only one way, e.g. 25-03-2018, vote for
+// their order and the majority decides. The order of the pattern layout is
+// assumed on a tie.
+func (this *filenameTimeSource) Prepare(files []*fileinfo) {
+	votes := make(map[string]int)
+	for _, file := range files {
+		pattern, value := findFilenamePattern(file.info.Name())
+		if pattern == nil || !pattern.ambiguous {
+			continue
+		}
+		_, err := pattern.parse(value, false)
+		_, swappedErr := pattern.parse(value, true)
+		dir := filepath.Dir(file.path)
+		if err == nil && swappedErr != nil {
+			votes[dir]--
+		} else if err != nil && swappedErr == nil {
+			votes[dir]++
+		}
+	}
+
+	this.swapped = make(map[string]bool)
+	for dir, vote := range votes {
+		if vote > 0 {
+			this.swapped[dir] = true
+		}
+	}
+}
+
+func (this *filenameTimeSource) Extract(file *fileinfo) (time.Time, confidence, error) {
+	candidates, err := this.Candidates(file)
+	if err != nil {
+		return time.Time{}, confidenceNone, err
+	}
+	return candidates[0].time, candidates[0].confidence, nil
+}
+
+// Candidates returns time encoded in the name, with precision of the
+// layout, e.g. day when the name has no time of day.
+func (this *filenameTimeSource) Candidates(file *fileinfo) ([]timeCandidate, error) {
+	pattern, value := findFilenamePattern(file.info.Name())
+	if pattern == nil {
+		return nil, errNoTime
+	}
+
+	swapped := this.swapped[filepath.Dir(file.path)]
+	time, err := pattern.parse(value, swapped)
+	if err != nil && pattern.ambiguous {
+		time, err = pattern.parse(value, !swapped)
+	}
+	if err != nil {
+		return nil, errNoTime
+	}
+	return []timeCandidate{{
+		source:     "filename",
+		time:       time,
+		precision:  pattern.precision,
+		confidence: confidenceMedium,
+	}}, nil
+}
@@ -0,0 +1,181 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeFileInfo is os.FileInfo for files which do not exist on disk.
+type fakeFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (this *fakeFileInfo) Name() string       { return this.name }
+func (this *fakeFileInfo) Size() int64        { return this.size }
+func (this *fakeFileInfo) Mode() os.FileMode  { return 0644 }
+func (this *fakeFileInfo) ModTime() time.Time { return this.modTime }
+func (this *fakeFileInfo) IsDir() bool        { return false }
+func (this *fakeFileInfo) Sys() interface{}   { return nil }
+
+func mkFakeFile(path string) *fileinfo {
+	return &fileinfo{
+		path: path,
+		info: &fakeFileInfo{name: filepath.Base(path)},
+	}
+}
+
+func TestFilenameTimeSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"IMG_20180304_123456.jpg", "2018-03-04 12:34:56"},
+		{"VID_20181231_203040.mp4", "2018-12-31 20:30:40"},
+		{"PANO_20180304_123456.jpg", "2018-03-04 12:34:56"},
+		{"PXL_20200101_123456789.jpg", "2020-01-01 12:34:56"},
+		{"PXL_20200101_123456789.MP.jpg", "2020-01-01 12:34:56"},
+		{"20180304_123456.jpg", "2018-03-04 12:34:56"},
+		{"20180304_123456(0).jpg", "2018-03-04 12:34:56"},
+		{"2018-03-04 12.34.56.mp4", "2018-03-04 12:34:56"},
+		{"2018-03-04 12.34.56-1.jpg", "2018-03-04 12:34:56"},
+		{"IMG-20180304-WA0001.jpg", "2018-03-04 00:00:00"},
+		{"VID-20180304-WA0012.mp4", "2018-03-04 00:00:00"},
+		{"Screenshot_20180304-123456.png", "2018-03-04 12:34:56"},
+		{"Screenshot_2018-03-04-12-34-56.png", "2018-03-04 12:34:56"},
+		{"Screen Shot 2018-03-04 at 12.34.56.png", "2018-03-04 12:34:56"},
+		{"Screen Shot 2018-03-04 at 1.34.56 PM.png", "2018-03-04 13:34:56"},
+		{"Screenshot 2018-03-04 at 12.34.56 AM.png", "2018-03-04 00:34:56"},
+		{"Screen Shot 2018-03-04 at 1.34.56\u202fPM.png", "2018-03-04 00:00:00"},
+		{"Screenshot 2018-03-04 at 12.34.56.png", "2018-03-04 12:34:56"},
+		{"Scan 04-03-2018.jpg", "2018-03-04 00:00:00"},
+		{"scan_25.12.2017.jpg", "2017-12-25 00:00:00"},
+		{"scan_12.25.2017.jpg", "2017-12-25 00:00:00"},
+		{"2018-03-04 Birthday.jpg", "2018-03-04 00:00:00"},
+		{"IMG_2018030_123456.jpg", ""},
+		{"DSC_0123.JPG", ""},
+		{"IMG_20181304_123456.jpg", ""},
+	}
+
+	source := &filenameTimeSource{}
+	for _, test := range tests {
+		time, conf, err := source.Extract(mkFakeFile("src/" + test.name))
+		if test.expected == "" {
+			if err != errNoTime {
+				t.Errorf("%s: expected no time, got:%s (%v)", test.name, time, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		} else if time.Format("2006-01-02 15:04:05") != test.expected {
+			t.Errorf("%s: expected:%s got:%s", test.name, test.expected, time)
+		} else if conf != confidenceMedium {
+			t.Errorf("%s: unexpected confidence: %s", test.name, conf)
+		}
+	}
+}
+
+func TestFilenameTimePrecision(t *testing.T) {
+	defer func() { filenamePatterns = mustCompileFilenamePatterns(nil) }()
+	filenamePatterns = mustCompileFilenamePatterns([]string{`yyyy-mm=^Album (?P<time>\d{4}-\d{2})`})
+
+	tests := []struct {
+		name      string
+		precision timePrecision
+	}{
+		{"IMG_20180304_123456.jpg", precisionFull},
+		{"Screen Shot 2018-03-04 at 1.34.56 PM.png", precisionFull},
+		{"IMG-20180304-WA0001.jpg", precisionDay},
+		{"Scan 04-03-2018.jpg", precisionDay},
+		{"2018-03-04 Birthday.jpg", precisionDay},
+		{"Album 2018-03 01.jpg", precisionMonth},
+	}
+
+	source := &filenameTimeSource{}
+	for _, test := range tests {
+		candidates, err := source.Candidates(mkFakeFile("src/" + test.name))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		} else if candidates[0].precision != test.precision {
+			t.Errorf("%s: expected:%s got:%s", test.name, test.precision, candidates[0].precision)
+		}
+	}
+}
+
+func TestFilenameTimeSourceAmbiguous(t *testing.T) {
+	files := []*fileinfo{
+		// day first directory
+		mkFakeFile("eu/Scan 03-04-2018.jpg"),
+		mkFakeFile("eu/Scan 25-04-2018.jpg"),
+		// month first directory
+		mkFakeFile("us/Scan 03-04-2018.jpg"),
+		mkFakeFile("us/Scan 04-25-2018.jpg"),
+		mkFakeFile("us/Scan 12-31-2018.jpg"),
+		// undecided directory
+		mkFakeFile("xx/Scan 03-04-2018.jpg"),
+	}
+	expected := []string{
+		"2018-04-03",
+		"2018-04-25",
+		"2018-03-04",
+		"2018-04-25",
+		"2018-12-31",
+		"2018-04-03",
+	}
+
+	source := &filenameTimeSource{}
+	source.Prepare(files)
+	for i, file := range files {
+		time, _, err := source.Extract(file)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", file.path, err)
+		} else if time.Format("2006-01-02") != expected[i] {
+			t.Errorf("%s: expected:%s got:%s", file.path, expected[i], time)
+		}
+	}
+}
+
+func TestCompileFilenamePatterns(t *testing.T) {
+	patterns, err := compileFilenamePatterns([]string{`yyyymmdd=^DSC(?P<time>[0-9]{8})`})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(patterns) != len(builtinFilenamePatterns)+1 {
+		t.Errorf("unexpected number of patterns: %d", len(patterns))
+	}
+	if value, ok := patterns[0].match("DSC20180304.jpg"); !ok || value != "20180304" {
+		t.Errorf("user pattern did not match: %s", value)
+	}
+
+	invalid := []string{
+		`^DSC(?P<time>[0-9]{8})`,
+		`yyyymmdd=^DSC([0-9]{8})`,
+		`yyyymmdd=^DSC(?P<time>[0-9]{8}`,
+		`=^DSC(?P<time>[0-9]{8})`,
+		`yyyyww=^DSC(?P<time>[0-9]{6})`,
+		`yyyymmdd at HHMM=^DSC(?P<time>.*)`,
+	}
+	for _, value := range invalid {
+		if _, err := compileFilenamePatterns([]string{value}); err == nil {
+			t.Errorf("%s: expected error", value)
+		}
+	}
+}
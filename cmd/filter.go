@@ -0,0 +1,67 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// minRating excludes files rated lower; -1 includes rejected files.
+var minRating int
+
+// requiredKeywords limits processing to files with at least one of them.
+var requiredKeywords []string
+
+// filterReason returns why the file is excluded by meta data filters, or
+// empty string if it is not.
+func filterReason(file *fileinfo) string {
+	if minRating > -1 {
+		rating := 0
+		if value, ok := file.metadata[metadataRating]; ok {
+			rating, _ = strconv.Atoi(value)
+		}
+		if rating < minRating {
+			return fmt.Sprintf("rating %d", rating)
+		}
+	}
+
+	if len(requiredKeywords) > 0 {
+		for _, required := range requiredKeywords {
+			for _, keyword := range file.keywords {
+				if strings.EqualFold(strings.TrimSpace(keyword), strings.TrimSpace(required)) {
+					return ""
+				}
+			}
+		}
+		return "no matching keyword"
+	}
+	return ""
+}
+
+// xmpMetadataNeeded returns true if filters or formats use rating or
+// keywords, which are read from XMP.
+func xmpMetadataNeeded() bool {
+	if minRating > -1 || len(requiredKeywords) > 0 {
+		return true
+	}
+	for _, format := range []string{destinationDirectoryFormat, nameFormat, eventFormat} {
+		if usesMetadataField(format, metadataRating) || usesMetadataField(format, metadataKeywords) {
+			return true
+		}
+	}
+	return false
+}
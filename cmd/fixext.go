@@ -0,0 +1,253 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// extensionMap maps extension variants onto preferred ones, without dots.
+var extensionMap map[string]string
+
+var defaultExtensionMap = map[string]string{
+	"jpeg": "jpg",
+	"jpe":  "jpg",
+	"tiff": "tif",
+}
+
+// mediaFamilies groups extensions parsed the same way; extension is
+// considered correct as long as it belongs to the family of the content.
+var mediaFamilies = map[string]string{
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".jpe":  "jpeg",
+	".png":  "png",
+	".gif":  "gif",
+	".webp": "webp",
+	".heic": "heif",
+	".heif": "heif",
+	".mp4":  "isomedia",
+	".m4v":  "isomedia",
+	".mov":  "isomedia",
+	".3gp":  "isomedia",
+	".tif":  "tiff",
+	".tiff": "tiff",
+	".cr2":  "tiff",
+	".nef":  "tiff",
+	".arw":  "tiff",
+	".dng":  "tiff",
+	".orf":  "tiff",
+	".rw2":  "tiff",
+	".avi":  "avi",
+	".mkv":  "matroska",
+	".webm": "matroska",
+	".mts":  "mts",
+	".m2ts": "m2ts",
+}
+
+// fixExtensionsCmd represents the fix-extensions command
+var fixExtensionsCmd = &cobra.Command{
+	Use:   "fix-extensions path [path...]",
+	Short: "Rename files whose extension does not match their content.",
+	Long: `Rename files whose extension does not match their content.
+
+Type of each file is recognized from its content, and files with extensions of
+other types, e.g. PNG images named .jpg, or without extension get the
+extension of their type. Unknown extensions, e.g. .m4a or .pef, are left
+alone. Extensions of recognized files are also normalized to lower case and
+to preferred variants given with --ext-map, e.g. .JPEG to .jpg. XMP and Google
+Takeout sidecars are renamed along; files whose sidecar would overwrite
+another file are skipped. When the new name is taken, -1, -2 etc. is
+appended.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := fixExtensions(args); err != nil {
+			Print("Error: %s\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fixExtensionsCmd)
+
+	fixExtensionsCmd.Flags().StringToStringVar(&extensionMap, "ext-map", defaultExtensionMap, "Preferred extensions, e.g. jpeg=jpg. Extensions are also converted to lower case.")
+	fixExtensionsCmd.Flags().BoolVar(&hiddenFiles, "hidden-files", false, "Process hidden files. Default is only normal files.")
+}
+
+// normalizeExtension returns lower case extension, mapped using --ext-map.
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(ext)
+	if mapped, ok := extensionMap[strings.TrimPrefix(ext, ".")]; ok {
+		return "." + strings.TrimPrefix(strings.ToLower(mapped), ".")
+	}
+	return ext
+}
+
+// correctExtension returns extension the file should have, given the type
+// recognized from its content. Extensions which are not media extensions are
+// kept, since they may name a more specific type of the same container, e.g.
+// .m4a or .pef.
+func correctExtension(ext, detected string) string {
+	if ext == "" {
+		return normalizeExtension(detected)
+	}
+	family, ok := mediaFamilies[strings.ToLower(ext)]
+	if !ok {
+		return ext
+	}
+	if family != mediaFamilies[detected] {
+		return normalizeExtension(detected)
+	}
+	return normalizeExtension(ext)
+}
+
+// acceptMediaFile accepts readable regular files, which are then
+// recognized by content.
+func acceptMediaFile(path string, info os.FileInfo) (accepted bool, reason string) {
+	if !info.Mode().IsRegular() {
+		return false, "not regular file"
+	}
+	if !hiddenFiles && info.Name()[0] == '.' {
+		return false, "hidden file"
+	}
+	return true, ""
+}
+
+func fixExtensions(paths []string) error {
+	for _, path := range paths {
+		files, err := getFiles(path, acceptMediaFile)
+		if err != nil {
+			return err
+		}
+
+		// names given to files in this run, which are not yet there in dry run
+		taken := make(map[string]bool)
+		for _, file := range files {
+			detected := detectMediaType(file.path)
+			if detected == "" {
+				Info("%s: skipping, type not recognized\n", file.path)
+				continue
+			}
+			ext := filepath.Ext(file.path)
+			newExt := correctExtension(ext, detected)
+			if newExt == ext {
+				continue
+			}
+
+			newPath, err := freeName(strings.TrimSuffix(file.path, ext), newExt, file.info, taken)
+			if err != nil {
+				file.message = fmt.Sprintf("%s: %s", file.path, err)
+				Print("%s\n", file.message)
+				continue
+			}
+			renameWithSidecars(file, newPath, taken)
+		}
+	}
+	return nil
+}
+
+// freeName returns base+ext if not taken by another file, or the first of
+// base-1+ext, base-2+ext etc. which is not.
+func freeName(base, ext string, info os.FileInfo, taken map[string]bool) (string, error) {
+	for i := 0; i <= 999; i++ {
+		path := base + ext
+		if i > 0 {
+			path = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+		if taken[path] {
+			continue
+		}
+		existing, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return path, nil
+		} else if err != nil {
+			return "", fmt.Errorf("problem checking destination: %s", err)
+		} else if os.SameFile(info, existing) {
+			// only case differs, on case insensitive file system
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("too many files named %s", base+ext)
+}
+
+// renameWithSidecars renames the file, and its sidecars whose names include
+// the extension. Nothing is renamed if the new name of any sidecar is taken.
+func renameWithSidecars(file *fileinfo, newPath string, taken map[string]bool) {
+	sidecars := findXmpSidecars(file.path)
+	if path := findTakeoutSidecar(file.path); path != "" {
+		sidecars = append(sidecars, sidecarFile{path: path, suffix: ".json"})
+	}
+
+	moves := [][2]string{{file.path, newPath}}
+	for _, sidecar := range sidecars {
+		sidecarPath := sidecar.newPath(newPath)
+		if sidecarPath == sidecar.path {
+			continue
+		}
+		if err := checkRenameTarget(sidecar.path, sidecarPath, taken); err != nil {
+			file.message = fmt.Sprintf("%s: skipping, %s", file.path, err)
+			Print("%s\n", file.message)
+			return
+		}
+		moves = append(moves, [2]string{sidecar.path, sidecarPath})
+	}
+
+	for i, move := range moves {
+		taken[move[1]] = true
+		if !rename(file, move[0], move[1]) && i == 0 {
+			return
+		}
+	}
+}
+
+// checkRenameTarget returns error if newpath is taken by a file other than
+// oldpath, or by another file renamed in this run.
+func checkRenameTarget(oldpath, newpath string, taken map[string]bool) error {
+	if taken[newpath] {
+		return fmt.Errorf("destination %s already exists", newpath)
+	}
+	existing, err := os.Lstat(newpath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("problem checking destination: %s", err)
+	}
+	if info, err := os.Lstat(oldpath); err == nil && os.SameFile(info, existing) {
+		// only case differs, on case insensitive file system
+		return nil
+	}
+	return fmt.Errorf("destination %s already exists", newpath)
+}
+
+// rename moves oldpath to newpath unless in dry run, recording the outcome
+// in file message.
+func rename(file *fileinfo, oldpath, newpath string) bool {
+	file.message = fmt.Sprintf("mv %s %s", oldpath, newpath)
+	Print("%s\n", file.message)
+	if dryRun {
+		return true
+	}
+	if err := OS.Rename(oldpath, newpath); err != nil {
+		file.message = fmt.Sprintf("%s: failed to rename: %s", oldpath, err)
+		Print("%s\n", file.message)
+		return false
+	}
+	return true
+}
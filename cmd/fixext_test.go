@@ -0,0 +1,120 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestCorrectExtension(t *testing.T) {
+	extensionMap = defaultExtensionMap
+	tests := []struct {
+		ext      string
+		detected string
+		expected string
+	}{
+		{".jpg", ".jpg", ".jpg"},
+		{".JPG", ".jpg", ".jpg"},
+		{".JPEG", ".jpg", ".jpg"},
+		{".jpg", ".png", ".png"},
+		{".JPG", ".heic", ".heic"},
+		{".heif", ".heic", ".heif"},
+		{".NEF", ".tif", ".nef"},
+		{".tiff", ".tif", ".tif"},
+		{".mov", ".mp4", ".mov"},
+		{".dat", ".mts", ".dat"},
+		{".m4a", ".mp4", ".m4a"},
+		{".pef", ".tif", ".pef"},
+		{".SRW", ".tif", ".SRW"},
+		{"", ".jpg", ".jpg"},
+	}
+	for _, test := range tests {
+		if actual := correctExtension(test.ext, test.detected); actual != test.expected {
+			t.Errorf("%s as %s: expected:%s got:%s", test.ext, test.detected, test.expected, actual)
+		}
+	}
+
+	extensionMap = map[string]string{"jpg": ".JPEG"}
+	defer func() { extensionMap = defaultExtensionMap }()
+	if actual := correctExtension(".jpg", ".jpg"); actual != ".jpeg" {
+		t.Errorf("expected .jpeg, got: %s", actual)
+	}
+}
+
+func TestFixExtensions(t *testing.T) {
+	jpeg, err := ioutil.ReadFile("../test/exif-20180101.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"received.PNG":      jpeg,
+		"IMG_0001.JPEG":     jpeg,
+		"IMG_0001.JPEG.xmp": []byte(sidecarXmp),
+		"screenshot.jpg":    mkPng(),
+		"screenshot.png":    mkPng(),
+		"photo.jpg":         jpeg,
+		"notes.TXT":         []byte("notes"),
+		"voice.m4a":         mkMp4Box("ftyp", []byte("isom\x00\x00\x02\x00")),
+		"IMG_0002.PEF":      []byte("II*\x00\x08\x00\x00\x00"),
+		"IMG_0003.JPEG":     jpeg,
+		"IMG_0003.JPEG.xmp": []byte(sidecarXmp),
+		"IMG_0003.jpg.xmp":  []byte(sidecarXmp),
+	}
+
+	for _, dry := range []bool{true, false} {
+		dir, err := ioutil.TempDir("", "photo-cleanup")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		for name, data := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		dryRun = dry
+		InitProdOs()
+		extensionMap = defaultExtensionMap
+		if err := fixExtensions([]string{dir}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		dryRun = false
+
+		// IMG_0003 is skipped, since its sidecar would overwrite existing one
+		expected := []string{"IMG_0001.jpg", "IMG_0001.jpg.xmp", "IMG_0002.PEF", "IMG_0003.JPEG", "IMG_0003.JPEG.xmp", "IMG_0003.jpg.xmp",
+			"notes.TXT", "photo.jpg", "received.jpg", "screenshot-1.png", "screenshot.png", "voice.m4a"}
+		if dry {
+			expected = []string{"IMG_0001.JPEG", "IMG_0001.JPEG.xmp", "IMG_0002.PEF", "IMG_0003.JPEG", "IMG_0003.JPEG.xmp", "IMG_0003.jpg.xmp",
+				"notes.TXT", "photo.jpg", "received.PNG", "screenshot.jpg", "screenshot.png", "voice.m4a"}
+		}
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actual []string
+		for _, info := range infos {
+			actual = append(actual, info.Name())
+		}
+		sort.Strings(actual)
+		if diff, equal := Diff(expected, actual); !equal {
+			t.Errorf("dry run %v: %s", dry, diff)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// geoNamesFile is GeoNames cities file used for reverse geocoding.
+var geoNamesFile string
+
+// geocoder finds places nearest to photo locations; nil when no GeoNames
+// file is given.
+var geocoder *reverseGeocoder
+
+// geocodeMaxDistance is the largest distance in kilometers between photo and
+// the nearest place for the place to be used.
+const geocodeMaxDistance = 100.0
+
+// GeoNames columns, see http://download.geonames.org/export/dump/readme.txt
+const (
+	geoNamesName         = 1
+	geoNamesLatitude     = 4
+	geoNamesLongitude    = 5
+	geoNamesFeatureClass = 6
+	geoNamesCountryCode  = 8
+	geoNamesColumns      = 9
+)
+
+// geoPlace is a populated place from GeoNames.
+type geoPlace struct {
+	name        string
+	countryCode string
+}
+
+// country returns English name of the country of the place, or its ISO code
+// if the name is not known.
+func (this *geoPlace) country() string {
+	if name, ok := countryNames[this.countryCode]; ok {
+		return name
+	}
+	return this.countryCode
+}
+
+// reverseGeocoder finds the place nearest to a location using k-d tree of
+// place positions, which are points on unit sphere. Distance between such
+// points grows with distance along the surface, so the nearest point is the
+// nearest place.
+type reverseGeocoder struct {
+	places []geoPlace
+	tree   *kdTree
+}
+
+// spherePoint returns the location as point on unit sphere.
+func spherePoint(location *geoLocation) kdPoint {
+	lat := location.latitude * math.Pi / 180
+	long := location.longitude * math.Pi / 180
+	return kdPoint{math.Cos(lat) * math.Cos(long), math.Cos(lat) * math.Sin(long), math.Sin(lat)}
+}
+
+// newReverseGeocoder indexes the places at the locations.
+func newReverseGeocoder(places []geoPlace, locations []geoLocation) *reverseGeocoder {
+	points := make([]kdPoint, len(locations))
+	for i := range locations {
+		points[i] = spherePoint(&locations[i])
+	}
+	return &reverseGeocoder{places: places, tree: newKdTree(points)}
+}
+
+// nearest returns the place nearest to the location, or nil if there is no
+// place within geocodeMaxDistance.
+func (this *reverseGeocoder) nearest(location *geoLocation) *geoPlace {
+	index, chord2 := this.tree.nearest(spherePoint(location))
+	if index < 0 {
+		return nil
+	}
+	// chord length between points on unit sphere to distance along surface
+	if 2*earthRadius*math.Asin(math.Min(1, math.Sqrt(chord2)/2)) > geocodeMaxDistance {
+		return nil
+	}
+	return &this.places[index]
+}
+
+// loadGeoNames reads GeoNames file, e.g. cities1000.txt, or zip archive as
+// downloaded from GeoNames, e.g. cities1000.zip.
+func loadGeoNames(path string) (*reverseGeocoder, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".zip") {
+		is, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer is.Close()
+		return readGeoNames(is, path)
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	for _, file := range archive.File {
+		name := strings.ToLower(filepath.Base(file.Name))
+		if filepath.Ext(name) != ".txt" || strings.HasPrefix(name, "readme") {
+			continue
+		}
+		is, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer is.Close()
+		return readGeoNames(is, path)
+	}
+	return nil, fmt.Errorf("%s: no GeoNames file in archive", path)
+}
+
+// readGeoNames reads tab separated GeoNames records of populated places;
+// other features are ignored.
+func readGeoNames(r io.Reader, path string) (*reverseGeocoder, error) {
+	var places []geoPlace
+	var locations []geoLocation
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) < geoNamesColumns {
+			return nil, fmt.Errorf("%s: line %d: expected at least %d columns", path, line, geoNamesColumns)
+		}
+		if fields[geoNamesFeatureClass] != "P" {
+			continue
+		}
+		latitude, err := strconv.ParseFloat(fields[geoNamesLatitude], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: invalid latitude '%s'", path, line, fields[geoNamesLatitude])
+		}
+		longitude, err := strconv.ParseFloat(fields[geoNamesLongitude], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: invalid longitude '%s'", path, line, fields[geoNamesLongitude])
+		}
+		places = append(places, geoPlace{name: fields[geoNamesName], countryCode: fields[geoNamesCountryCode]})
+		locations = append(locations, geoLocation{latitude, longitude})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if len(places) == 0 {
+		return nil, fmt.Errorf("%s: no populated places found", path)
+	}
+	return newReverseGeocoder(places, locations), nil
+}
+
+// initGeocoder loads --geonames file.
+func initGeocoder() error {
+	geocoder = nil
+	if geoNamesFile == "" {
+		return nil
+	}
+
+	var err error
+	if geocoder, err = loadGeoNames(geoNamesFile); err != nil {
+		return fmt.Errorf("--geonames: %s", err)
+	}
+	return nil
+}
+
+// geocodedField returns city or country of the place nearest to where the
+// file was taken, or empty string if not known.
+func geocodedField(file *fileinfo, name string) string {
+	if geocoder == nil || file.location == nil {
+		return ""
+	}
+	place := geocoder.nearest(file.location)
+	if place == nil {
+		return ""
+	}
+	switch name {
+	case metadataCity:
+		return place.name
+	case metadataCountry:
+		return place.country()
+	}
+	return ""
+}
+
+// countryNames map ISO 3166 country codes used by GeoNames onto English
+// names.
+var countryNames = map[string]string{
+	"AD": "Andorra",
+	"AE": "United Arab Emirates",
+	"AF": "Afghanistan",
+	"AG": "Antigua and Barbuda",
+	"AI": "Anguilla",
+	"AL": "Albania",
+	"AM": "Armenia",
+	"AO": "Angola",
+	"AQ": "Antarctica",
+	"AR": "Argentina",
+	"AS": "American Samoa",
+	"AT": "Austria",
+	"AU": "Australia",
+	"AW": "Aruba",
+	"AX": "Aland Islands",
+	"AZ": "Azerbaijan",
+	"BA": "Bosnia and Herzegovina",
+	"BB": "Barbados",
+	"BD": "Bangladesh",
+	"BE": "Belgium",
+	"BF": "Burkina Faso",
+	"BG": "Bulgaria",
+	"BH": "Bahrain",
+	"BI": "Burundi",
+	"BJ": "Benin",
+	"BL": "Saint Barthelemy",
+	"BM": "Bermuda",
+	"BN": "Brunei",
+	"BO": "Bolivia",
+	"BQ": "Bonaire, Saint Eustatius and Saba",
+	"BR": "Brazil",
+	"BS": "Bahamas",
+	"BT": "Bhutan",
+	"BW": "Botswana",
+	"BY": "Belarus",
+	"BZ": "Belize",
+	"CA": "Canada",
+	"CC": "Cocos Islands",
+	"CD": "Democratic Republic of the Congo",
+	"CF": "Central African Republic",
+	"CG": "Republic of the Congo",
+	"CH": "Switzerland",
+	"CI": "Ivory Coast",
+	"CK": "Cook Islands",
+	"CL": "Chile",
+	"CM": "Cameroon",
+	"CN": "China",
+	"CO": "Colombia",
+	"CR": "Costa Rica",
+	"CU": "Cuba",
+	"CV": "Cabo Verde",
+	"CW": "Curacao",
+	"CX": "Christmas Island",
+	"CY": "Cyprus",
+	"CZ": "Czechia",
+	"DE": "Germany",
+	"DJ": "Djibouti",
+	"DK": "Denmark",
+	"DM": "Dominica",
+	"DO": "Dominican Republic",
+	"DZ": "Algeria",
+	"EC": "Ecuador",
+	"EE": "Estonia",
+	"EG": "Egypt",
+	"EH": "Western Sahara",
+	"ER": "Eritrea",
+	"ES": "Spain",
+	"ET": "Ethiopia",
+	"FI": "Finland",
+	"FJ": "Fiji",
+	"FK": "Falkland Islands",
+	"FM": "Micronesia",
+	"FO": "Faroe Islands",
+	"FR": "France",
+	"GA": "Gabon",
+	"GB": "United Kingdom",
+	"GD": "Grenada",
+	"GE": "Georgia",
+	"GF": "French Guiana",
+	"GG": "Guernsey",
+	"GH": "Ghana",
+	"GI": "Gibraltar",
+	"GL": "Greenland",
+	"GM": "Gambia",
+	"GN": "Guinea",
+	"GP": "Guadeloupe",
+	"GQ": "Equatorial Guinea",
+	"GR": "Greece",
+	"GS": "South Georgia and the South Sandwich Islands",
+	"GT": "Guatemala",
+	"GU": "Guam",
+	"GW": "Guinea-Bissau",
+	"GY": "Guyana",
+	"HK": "Hong Kong",
+	"HN": "Honduras",
+	"HR": "Croatia",
+	"HT": "Haiti",
+	"HU": "Hungary",
+	"ID": "Indonesia",
+	"IE": "Ireland",
+	"IL": "Israel",
+	"IM": "Isle of Man",
+	"IN": "India",
+	"IO": "British Indian Ocean Territory",
+	"IQ": "Iraq",
+	"IR": "Iran",
+	"IS": "Iceland",
+	"IT": "Italy",
+	"JE": "Jersey",
+	"JM": "Jamaica",
+	"JO": "Jordan",
+	"JP": "Japan",
+	"KE": "Kenya",
+	"KG": "Kyrgyzstan",
+	"KH": "Cambodia",
+	"KI": "Kiribati",
+	"KM": "Comoros",
+	"KN": "Saint Kitts and Nevis",
+	"KP": "North Korea",
+	"KR": "South Korea",
+	"KW": "Kuwait",
+	"KY": "Cayman Islands",
+	"KZ": "Kazakhstan",
+	"LA": "Laos",
+	"LB": "Lebanon",
+	"LC": "Saint Lucia",
+	"LI": "Liechtenstein",
+	"LK": "Sri Lanka",
+	"LR": "Liberia",
+	"LS": "Lesotho",
+	"LT": "Lithuania",
+	"LU": "Luxembourg",
+	"LV": "Latvia",
+	"LY": "Libya",
+	"MA": "Morocco",
+	"MC": "Monaco",
+	"MD": "Moldova",
+	"ME": "Montenegro",
+	"MF": "Saint Martin",
+	"MG": "Madagascar",
+	"MH": "Marshall Islands",
+	"MK": "North Macedonia",
+	"ML": "Mali",
+	"MM": "Myanmar",
+	"MN": "Mongolia",
+	"MO": "Macao",
+	"MP": "Northern Mariana Islands",
+	"MQ": "Martinique",
+	"MR": "Mauritania",
+	"MS": "Montserrat",
+	"MT": "Malta",
+	"MU": "Mauritius",
+	"MV": "Maldives",
+	"MW": "Malawi",
+	"MX": "Mexico",
+	"MY": "Malaysia",
+	"MZ": "Mozambique",
+	"NA": "Namibia",
+	"NC": "New Caledonia",
+	"NE": "Niger",
+	"NF": "Norfolk Island",
+	"NG": "Nigeria",
+	"NI": "Nicaragua",
+	"NL": "Netherlands",
+	"NO": "Norway",
+	"NP": "Nepal",
+	"NR": "Nauru",
+	"NU": "Niue",
+	"NZ": "New Zealand",
+	"OM": "Oman",
+	"PA": "Panama",
+	"PE": "Peru",
+	"PF": "French Polynesia",
+	"PG": "Papua New Guinea",
+	"PH": "Philippines",
+	"PK": "Pakistan",
+	"PL": "Poland",
+	"PM": "Saint Pierre and Miquelon",
+	"PN": "Pitcairn",
+	"PR": "Puerto Rico",
+	"PS": "Palestinian Territory",
+	"PT": "Portugal",
+	"PW": "Palau",
+	"PY": "Paraguay",
+	"QA": "Qatar",
+	"RE": "Reunion",
+	"RO": "Romania",
+	"RS": "Serbia",
+	"RU": "Russia",
+	"RW": "Rwanda",
+	"SA": "Saudi Arabia",
+	"SB": "Solomon Islands",
+	"SC": "Seychelles",
+	"SD": "Sudan",
+	"SE": "Sweden",
+	"SG": "Singapore",
+	"SH": "Saint Helena",
+	"SI": "Slovenia",
+	"SJ": "Svalbard and Jan Mayen",
+	"SK": "Slovakia",
+	"SL": "Sierra Leone",
+	"SM": "San Marino",
+	"SN": "Senegal",
+	"SO": "Somalia",
+	"SR": "Suriname",
+	"SS": "South Sudan",
+	"ST": "Sao Tome and Principe",
+	"SV": "El Salvador",
+	"SX": "Sint Maarten",
+	"SY": "Syria",
+	"SZ": "Eswatini",
+	"TC": "Turks and Caicos Islands",
+	"TD": "Chad",
+	"TF": "French Southern Territories",
+	"TG": "Togo",
+	"TH": "Thailand",
+	"TJ": "Tajikistan",
+	"TK": "Tokelau",
+	"TL": "Timor Leste",
+	"TM": "Turkmenistan",
+	"TN": "Tunisia",
+	"TO": "Tonga",
+	"TR": "Turkey",
+	"TT": "Trinidad and Tobago",
+	"TV": "Tuvalu",
+	"TW": "Taiwan",
+	"TZ": "Tanzania",
+	"UA": "Ukraine",
+	"UG": "Uganda",
+	"UM": "United States Minor Outlying Islands",
+	"US": "United States",
+	"UY": "Uruguay",
+	"UZ": "Uzbekistan",
+	"VA": "Vatican",
+	"VC": "Saint Vincent and the Grenadines",
+	"VE": "Venezuela",
+	"VG": "British Virgin Islands",
+	"VI": "U.S. Virgin Islands",
+	"VN": "Vietnam",
+	"VU": "Vanuatu",
+	"WF": "Wallis and Futuna",
+	"WS": "Samoa",
+	"XK": "Kosovo",
+	"YE": "Yemen",
+	"YT": "Mayotte",
+	"ZA": "South Africa",
+	"ZM": "Zambia",
+	"ZW": "Zimbabwe",
+}
@@ -0,0 +1,142 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testGeoNames are GeoNames records, with columns after country code cut.
+const testGeoNames = "3169070\tRome\tRome\tRoma\t41.89193\t12.51133\tP\tPPLC\tIT\n" +
+	"3173435\tMilan\tMilan\tMilano\t45.46427\t9.18951\tP\tPPLA\tIT\n" +
+	"792680\tBelgrade\tBelgrade\tBeograd\t44.80401\t20.46513\tP\tPPLC\tRS\n" +
+	"3194360\tNovi Sad\tNovi Sad\t\t45.25167\t19.83694\tP\tPPLA\tRS\n" +
+	"3186886\tZagreb\tZagreb\t\t45.81444\t15.97798\tP\tPPLC\tHR\n" +
+	"3042030\tMont Blanc\tMont Blanc\t\t45.83262\t6.86517\tT\tMT\tFR\n" +
+	"0\tNowhere\tNowhere\t\t0\t0\tP\tPPL\tZZ\n"
+
+func TestReverseGeocoder(t *testing.T) {
+	geocoder, err := readGeoNames(strings.NewReader(testGeoNames), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(geocoder.places) != 6 {
+		t.Errorf("expected 6 places, got %d", len(geocoder.places))
+	}
+
+	tests := []struct {
+		location geoLocation
+		city     string
+		country  string
+	}{
+		{geoLocation{41.9029, 12.4534}, "Rome", "Italy"}, // Vatican
+		{geoLocation{44.8176, 20.4569}, "Belgrade", "Serbia"},
+		{geoLocation{45.2530, 19.8627}, "Novi Sad", "Serbia"}, // Petrovaradin
+		{geoLocation{45.8326, 6.8652}, "", ""},                // Mont Blanc is not a city, Milan is too far
+		{geoLocation{45.5845, 9.2744}, "Milan", "Italy"},      // Monza
+		{geoLocation{0.1, 0.1}, "Nowhere", "ZZ"},
+		{geoLocation{-33.8688, 151.2093}, "", ""}, // Sydney is too far
+	}
+	for _, test := range tests {
+		place := geocoder.nearest(&test.location)
+		switch {
+		case test.city == "" && place != nil:
+			t.Errorf("%v: expected no place, got %s", test.location, place.name)
+		case test.city == "":
+		case place == nil:
+			t.Errorf("%v: expected %s, got none", test.location, test.city)
+		case place.name != test.city || place.country() != test.country:
+			t.Errorf("%v: expected %s, %s got %s, %s", test.location, test.city, test.country, place.name, place.country())
+		}
+	}
+
+	invalid := []string{
+		"3169070\tRome\tRome\tRoma\t41.89193\n",
+		"3169070\tRome\tRome\tRoma\tnorth\t12.51133\tP\tPPLC\tIT\n",
+		"3042030\tMont Blanc\tMont Blanc\t\t45.83262\t6.86517\tT\tMT\tFR\n",
+	}
+	for _, data := range invalid {
+		if _, err := readGeoNames(strings.NewReader(data), "test"); err == nil {
+			t.Errorf("%q: expected error", data)
+		}
+	}
+}
+
+func TestGeocodedDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "photo-cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// GeoNames files are distributed as zip archives with readme
+	path := filepath.Join(dir, "cities1000.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(out)
+	for name, data := range map[string]string{"readme.txt": "GeoNames", "cities1000.txt": testGeoNames} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		geoNamesFile = ""
+		geocoder = nil
+	}()
+	geoNamesFile = path
+	if err := initGeocoder(); err != nil {
+		t.Fatal(err)
+	}
+
+	taken := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		file     *fileinfo
+		expected string
+	}{
+		{&fileinfo{path: "IMG_0001.JPG", location: &geoLocation{41.9029, 12.4534}}, "2019/Italy/Rome"},
+		{&fileinfo{path: "IMG_0002.JPG"}, "2019/unknown/unknown"},
+		// IPTC location entered by the user takes precedence
+		{&fileinfo{path: "IMG_0003.JPG", location: &geoLocation{41.9029, 12.4534}, metadata: map[string]string{metadataCity: "Vatican"}}, "2019/Italy/Vatican"},
+	}
+	for _, test := range tests {
+		if got := mustParseTemplate(t, "yyyy/{country}/{city}", true).format(taken, test.file, 0); got != test.expected {
+			t.Errorf("%s: expected:%s got:%s", test.file.path, test.expected, got)
+		}
+	}
+
+	geoNamesFile = filepath.Join(dir, "missing.txt")
+	if err := initGeocoder(); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	gifExtension       = 0x21
+	gifImageDescriptor = 0x2c
+	gifTrailer         = 0x3b
+	gifApplication     = 0xff
+)
+
+// gifXmpApplication identifies application extension holding XMP.
+var gifXmpApplication = []byte("XMP DataXMP")
+
+// decodeGif reads XMP application extension of GIF file. GIF has no other
+// place for capture time.
+func decodeGif(r io.ReaderAt, size int64) (*embeddedMetadata, error) {
+	br := bufio.NewReader(io.NewSectionReader(r, 0, size))
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("gif: reading header: %s", err)
+	}
+	if string(header[0:3]) != "GIF" {
+		return nil, errors.New("gif: not a gif file")
+	}
+	if header[10]&0x80 != 0 {
+		// global color table
+		if _, err := br.Discard(3 << (header[10]&0x07 + 1)); err != nil {
+			return nil, fmt.Errorf("gif: reading color table: %s", err)
+		}
+	}
+
+	metadata := &embeddedMetadata{}
+	for {
+		introducer, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("gif: reading block: %s", err)
+		}
+
+		switch introducer {
+		case gifTrailer:
+			return metadata, nil
+		case gifImageDescriptor:
+			descriptor := make([]byte, 10) // descriptor and LZW code size
+			if _, err := io.ReadFull(br, descriptor); err != nil {
+				return nil, fmt.Errorf("gif: reading image: %s", err)
+			}
+			if descriptor[8]&0x80 != 0 {
+				// local color table precedes LZW code size
+				if _, err := br.Discard(3<<(descriptor[8]&0x07+1) - 1); err != nil {
+					return nil, fmt.Errorf("gif: reading color table: %s", err)
+				}
+				if _, err := br.ReadByte(); err != nil {
+					return nil, fmt.Errorf("gif: reading image: %s", err)
+				}
+			}
+			if _, err := readGifSubBlocks(br); err != nil {
+				return nil, err
+			}
+		case gifExtension:
+			label, err := br.ReadByte()
+			if err != nil {
+				return nil, fmt.Errorf("gif: reading extension: %s", err)
+			}
+			data, err := readGifSubBlocks(br)
+			if err != nil {
+				return nil, err
+			}
+			if label == gifApplication && bytes.HasPrefix(data, append([]byte{byte(len(gifXmpApplication))}, gifXmpApplication...)) {
+				metadata.xmp = trimGifXmp(data[1+len(gifXmpApplication):])
+			}
+		default:
+			return nil, fmt.Errorf("gif: unknown block 0x%02x", introducer)
+		}
+	}
+}
+
+// readGifSubBlocks returns raw sub-blocks, including their length bytes, up
+// to the block terminator.
+func readGifSubBlocks(br *bufio.Reader) ([]byte, error) {
+	var data []byte
+	for {
+		length, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("gif: reading sub-block: %s", err)
+		}
+		if length == 0 {
+			return data, nil
+		}
+		block := make([]byte, length)
+		if _, err := io.ReadFull(br, block); err != nil {
+			return nil, fmt.Errorf("gif: reading sub-block: %s", err)
+		}
+		data = append(data, length)
+		data = append(data, block...)
+	}
+}
+
+// trimGifXmp removes the "magic trailer" which follows XMP packet stored in
+// GIF; XMP is stored as is, so that its bytes are read as sub-blocks.
+func trimGifXmp(data []byte) []byte {
+	for _, end := range [][]byte{[]byte("<?xpacket end="), []byte("</x:xmpmeta>")} {
+		if i := bytes.LastIndex(data, end); i >= 0 {
+			if j := bytes.Index(data[i:], []byte(">")); j >= 0 {
+				return data[:i+j+1]
+			}
+		}
+	}
+	return data
+}
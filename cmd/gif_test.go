@@ -0,0 +1,67 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+// mkGif returns 1x1 GIF with global and local color table, comment and,
+// unless empty, XMP application extension following the image.
+func mkGif(xmp string) []byte {
+	data := []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00")
+	data = append(data, make([]byte, 6)...) // global color table
+	data = append(data, gifExtension, 0xfe, 5, 'h', 'e', 'l', 'l', 'o', 0)
+	data = append(data, gifImageDescriptor, 0, 0, 0, 0, 1, 0, 1, 0, 0x81)
+	data = append(data, make([]byte, 12)...) // local color table
+	data = append(data, 2, 2, 0x4c, 0x01, 0) // LZW code size and data
+	if xmp != "" {
+		data = append(data, gifExtension, gifApplication, byte(len(gifXmpApplication)))
+		data = append(data, gifXmpApplication...)
+		data = append(data, xmp...)
+		// magic trailer
+		data = append(data, 1)
+		for i := 0xff; i >= 0; i-- {
+			data = append(data, byte(i))
+		}
+		data = append(data, 0)
+	}
+	return append(data, gifTrailer)
+}
+
+func TestDecodeGif(t *testing.T) {
+	xmp := `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?><x:xmpmeta xmlns:x="adobe:ns:meta/"/><?xpacket end="w"?>`
+	metadata, err := decodeGif(bytes.NewReader(mkGif(xmp)), int64(len(mkGif(xmp))))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(metadata.xmp) != xmp {
+		t.Errorf("xmp expected:%s got:%s", xmp, metadata.xmp)
+	}
+
+	metadata, err = decodeGif(bytes.NewReader(mkGif("")), int64(len(mkGif(""))))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if metadata.xmp != nil {
+		t.Errorf("unexpected xmp: %s", metadata.xmp)
+	}
+
+	for _, data := range [][]byte{[]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x00\x00"), mkGif(xmp)[:40]} {
+		if _, err := decodeGif(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("expected error for % x", data)
+		}
+	}
+}
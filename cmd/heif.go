@@ -0,0 +1,273 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var errNoHeifExif = errors.New("heif: no exif item")
+
+// heifExtent is a single contiguous part of item data.
+type heifExtent struct {
+	offset int64
+	length int64
+}
+
+// heifLocation describes where data of one item is stored, as declared in
+// iloc box.
+type heifLocation struct {
+	constructionMethod int
+	extents            []heifExtent
+}
+
+// decodeHeifExif finds the Exif item within HEIF (heic, heif) file and
+// returns its payload starting with TIFF header, ready to be passed to
+// exif.Decode.
+func decodeHeifExif(r io.ReaderAt, size int64) ([]byte, error) {
+	boxes, err := readMp4Boxes(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	if len(boxes) == 0 || boxes[0].typ != "ftyp" {
+		return nil, errors.New("heif: ftyp box not found")
+	}
+	meta := findMp4Box(boxes, "meta")
+	if meta == nil {
+		return nil, errors.New("heif: meta box not found")
+	}
+
+	// meta is a full box; skip version and flags
+	children, err := readMp4Boxes(r, meta.data+4, meta.end)
+	if err != nil {
+		return nil, err
+	}
+	iinf := findMp4Box(children, "iinf")
+	iloc := findMp4Box(children, "iloc")
+	if iinf == nil || iloc == nil {
+		return nil, errors.New("heif: iinf or iloc box not found")
+	}
+
+	itemID, err := findHeifItem(r, *iinf, "Exif")
+	if err != nil {
+		return nil, err
+	}
+	locations, err := readHeifLocations(r, *iloc)
+	if err != nil {
+		return nil, err
+	}
+	location, ok := locations[itemID]
+	if !ok {
+		return nil, fmt.Errorf("heif: no location for item %d", itemID)
+	}
+
+	var base int64
+	switch location.constructionMethod {
+	case 0: // offsets are relative to the beginning of the file
+	case 1: // offsets are relative to the payload of idat box
+		idat := findMp4Box(children, "idat")
+		if idat == nil {
+			return nil, errors.New("heif: idat box not found")
+		}
+		base = idat.data
+	default:
+		return nil, fmt.Errorf("heif: unsupported construction method %d", location.constructionMethod)
+	}
+
+	var data []byte
+	for _, extent := range location.extents {
+		if extent.length <= 0 || base+extent.offset+extent.length > size {
+			return nil, errors.New("heif: invalid exif item extent")
+		}
+		chunk := make([]byte, extent.length)
+		if _, err := r.ReadAt(chunk, base+extent.offset); err != nil {
+			return nil, fmt.Errorf("heif: reading exif item: %s", err)
+		}
+		data = append(data, chunk...)
+	}
+
+	// Exif item starts with offset to the TIFF header, which is usually
+	// preceded by "Exif\0\0"
+	if len(data) < 4 {
+		return nil, errors.New("heif: exif item too short")
+	}
+	headerOffset := int64(binary.BigEndian.Uint32(data[0:4]))
+	if 4+headerOffset >= int64(len(data)) {
+		return nil, errors.New("heif: invalid exif header offset")
+	}
+	return data[4+headerOffset:], nil
+}
+
+// findHeifItem returns id of the first item of the given type listed in iinf
+// box.
+func findHeifItem(r io.ReaderAt, iinf mp4Box, itemType string) (uint32, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, iinf.data); err != nil {
+		return 0, fmt.Errorf("heif: reading iinf box: %s", err)
+	}
+	start := iinf.data + 6 // version, flags and 16-bit entry count
+	if header[0] != 0 {
+		start += 2 // 32-bit entry count
+	}
+
+	entries, err := readMp4Boxes(r, start, iinf.end)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if entry.typ != "infe" || entry.end-entry.data < 12 {
+			continue
+		}
+		buf := make([]byte, 14)
+		n, err := r.ReadAt(buf, entry.data)
+		if err != nil && n < 12 {
+			return 0, fmt.Errorf("heif: reading infe box: %s", err)
+		}
+
+		var id uint32
+		var typ string
+		switch buf[0] {
+		case 2:
+			id = uint32(binary.BigEndian.Uint16(buf[4:6]))
+			typ = string(buf[8:12])
+		case 3:
+			if n < 14 {
+				continue
+			}
+			id = binary.BigEndian.Uint32(buf[4:8])
+			typ = string(buf[10:14])
+		default:
+			// versions 0 and 1 do not carry item type
+			continue
+		}
+		if typ == itemType {
+			return id, nil
+		}
+	}
+
+	return 0, errNoHeifExif
+}
+
+// readHeifLocations parses iloc box and returns locations of all items keyed
+// by item id.
+func readHeifLocations(r io.ReaderAt, iloc mp4Box) (map[uint32]heifLocation, error) {
+	data := make([]byte, iloc.end-iloc.data)
+	if _, err := r.ReadAt(data, iloc.data); err != nil {
+		return nil, fmt.Errorf("heif: reading iloc box: %s", err)
+	}
+
+	pos := 0
+	errShort := errors.New("heif: iloc box too short")
+	read := func(size int) (uint64, error) {
+		if pos+size > len(data) {
+			return 0, errShort
+		}
+		var value uint64
+		for _, b := range data[pos : pos+size] {
+			value = value<<8 | uint64(b)
+		}
+		pos += size
+		return value, nil
+	}
+
+	version, err := read(1)
+	if err != nil {
+		return nil, err
+	}
+	if version > 2 {
+		return nil, fmt.Errorf("heif: unsupported iloc version %d", version)
+	}
+	pos += 3 // flags
+
+	sizes, err := read(2)
+	if err != nil {
+		return nil, err
+	}
+	offsetSize := int(sizes >> 12 & 0xf)
+	lengthSize := int(sizes >> 8 & 0xf)
+	baseOffsetSize := int(sizes >> 4 & 0xf)
+	indexSize := 0
+	if version > 0 {
+		indexSize = int(sizes & 0xf)
+	}
+
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	itemCount, err := read(idSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// itemCount comes from the file; never preallocate more entries than the
+	// rest of the box can hold
+	entrySize := idSize + 2 + baseOffsetSize + 2
+	if version > 0 {
+		entrySize += 2
+	}
+	if itemCount > uint64((len(data)-pos)/entrySize) {
+		return nil, errShort
+	}
+	locations := make(map[uint32]heifLocation, itemCount)
+	for i := uint64(0); i < itemCount; i++ {
+		id, err := read(idSize)
+		if err != nil {
+			return nil, err
+		}
+		var location heifLocation
+		if version > 0 {
+			method, err := read(2)
+			if err != nil {
+				return nil, err
+			}
+			location.constructionMethod = int(method & 0xf)
+		}
+		if _, err := read(2); err != nil { // data reference index
+			return nil, err
+		}
+		baseOffset, err := read(baseOffsetSize)
+		if err != nil {
+			return nil, err
+		}
+		extentCount, err := read(2)
+		if err != nil {
+			return nil, err
+		}
+		for j := uint64(0); j < extentCount; j++ {
+			if _, err := read(indexSize); err != nil {
+				return nil, err
+			}
+			offset, err := read(offsetSize)
+			if err != nil {
+				return nil, err
+			}
+			length, err := read(lengthSize)
+			if err != nil {
+				return nil, err
+			}
+			location.extents = append(location.extents, heifExtent{
+				offset: int64(baseOffset + offset),
+				length: int64(length),
+			})
+		}
+		locations[uint32(id)] = location
+	}
+
+	return locations, nil
+}
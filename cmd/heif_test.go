@@ -0,0 +1,90 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/xor-gate/goexif2/exif"
+)
+
+func TestDecodeHeifExif(t *testing.T) {
+	file, err := os.Open("../test/heic-20190615.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	data, err := decodeHeifExif(file, mkInfo("../test/heic-20190615.heic").Size())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.HasPrefix(data, []byte("MM\x00*")) {
+		t.Fatalf("payload does not start with tiff header: % x", data[:4])
+	}
+
+	exinfo, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	time, err := exinfo.DateTime()
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if time.Format("2006-01-02 15:04:05") != "2019-06-15 18:30:00" {
+		t.Errorf("unexpected time: %s", time)
+	}
+	lat, long, err := exinfo.LatLong()
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if math.Abs(lat-45.815) > 0.001 || math.Abs(long-15.9819) > 0.001 {
+		t.Errorf("unexpected location: %f,%f", lat, long)
+	}
+	if model, err := exinfo.Get(exif.Model); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if value, _ := model.StringVal(); value != "iPhone XS" {
+		t.Errorf("unexpected model: %s", value)
+	}
+}
+
+func TestDecodeHeifExifInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"no ftyp", mkMp4Box("meta", make([]byte, 4))},
+		{"no meta", mkMp4Box("ftyp", []byte("heic"))},
+		{"no exif", append(mkMp4Box("ftyp", []byte("heic")), mkMp4Box("meta", make([]byte, 4),
+			mkMp4Box("iinf", make([]byte, 6)), mkMp4Box("iloc", []byte{0, 0, 0, 0, 0x44, 0, 0, 0}))...)},
+	}
+
+	for _, test := range tests {
+		if _, err := decodeHeifExif(bytes.NewReader(test.data), int64(len(test.data))); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
+
+func TestReadHeifLocationsHugeCount(t *testing.T) {
+	// version 2 iloc claiming 2^32-1 items followed by a single truncated entry
+	data := mkMp4Box("iloc", []byte{2, 0, 0, 0, 0x44, 0, 0xff, 0xff, 0xff, 0xff, 0, 0})
+	iloc := mp4Box{typ: "iloc", offset: 0, data: 8, end: int64(len(data))}
+	if _, err := readHeifLocations(bytes.NewReader(data), iloc); err == nil {
+		t.Errorf("expected error")
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const jpegAPP13 = 0xed
+
+// jpegPhotoshopHeader starts APP13 segment holding Photoshop image resources.
+var jpegPhotoshopHeader = []byte("Photoshop 3.0\x00")
+
+// photoshopIptcResource is the id of image resource holding IPTC-IIM data.
+const photoshopIptcResource = 0x0404
+
+// iptcDataset identifies IPTC-IIM dataset by record and dataset number.
+type iptcDataset struct {
+	record  byte
+	dataset byte
+}
+
+var (
+	iptcCodedCharacterSet = iptcDataset{1, 90}
+	iptcKeywords          = iptcDataset{2, 25}
+	iptcByline            = iptcDataset{2, 80}
+	iptcCity              = iptcDataset{2, 90}
+	iptcState             = iptcDataset{2, 95}
+	iptcCountry           = iptcDataset{2, 101}
+	iptcHeadline          = iptcDataset{2, 105}
+	iptcCaption           = iptcDataset{2, 120}
+)
+
+// iptcMetadataFields maps non repeatable datasets to metadata keys.
+var iptcMetadataFields = map[iptcDataset]string{
+	iptcCaption:  metadataCaption,
+	iptcHeadline: metadataHeadline,
+	iptcByline:   metadataByline,
+	iptcCity:     metadataCity,
+	iptcState:    metadataState,
+	iptcCountry:  metadataCountry,
+}
+
+// utf8Escape is the value of coded character set dataset declaring UTF-8.
+var utf8Escape = []byte("\x1b%G")
+
+var errNoIptc = errors.New("iptc: no iptc data")
+
+// iptcMetadata holds values of IPTC-IIM datasets; repeatable datasets, like
+// keywords, have multiple values.
+type iptcMetadata map[iptcDataset][]string
+
+// metadata returns values of non repeatable datasets keyed as in
+// fileinfo.metadata.
+func (this iptcMetadata) metadata() map[string]string {
+	metadata := make(map[string]string)
+	for dataset, key := range iptcMetadataFields {
+		if values := this[dataset]; len(values) > 0 {
+			metadata[key] = values[0]
+		}
+	}
+	return metadata
+}
+
+// keywords returns all keywords, which may contain commas themselves.
+func (this iptcMetadata) keywords() []string {
+	return this[iptcKeywords]
+}
+
+// readIptcMetadata stores IPTC of JPEG file into its metadata. IPTC is
+// independent of exif and often present without it, so it is read whether
+// or not exif time source is used.
+func readIptcMetadata(file *fileinfo) {
+	if !jpegFileTypes[file.mediaType()] {
+		return
+	}
+	is, err := os.Open(file.path)
+	if err != nil {
+		return
+	}
+	defer is.Close()
+
+	iptc, err := readJpegIptc(is)
+	if err != nil {
+		if err != errNoIptc {
+			Info("\r%s: error reading iptc (%s)\n", file.path, err)
+		}
+		return
+	}
+	for key, value := range iptc.metadata() {
+		file.setMetadata(key, value)
+	}
+	file.addKeywords(iptc.keywords())
+}
+
+// readJpegIptc reads IPTC-IIM data from Photoshop APP13 segment of JPEG file.
+func readJpegIptc(r io.ReaderAt) (iptcMetadata, error) {
+	segments, err := readJpegSegments(r)
+	if err != nil {
+		return nil, err
+	}
+	segment, err := findJpegSegment(r, segments, jpegAPP13, jpegPhotoshopHeader)
+	if err != nil {
+		return nil, err
+	} else if segment == nil {
+		return nil, errNoIptc
+	}
+
+	data := make([]byte, segment.length)
+	if _, err := r.ReadAt(data, segment.offset); err != nil {
+		return nil, fmt.Errorf("jpeg: reading app13: %s", err)
+	}
+	resource, err := findPhotoshopResource(data[len(jpegPhotoshopHeader):], photoshopIptcResource)
+	if err != nil {
+		return nil, err
+	}
+	return parseIptc(resource)
+}
+
+// findPhotoshopResource returns data of 8BIM image resource with the id.
+func findPhotoshopResource(data []byte, id uint16) ([]byte, error) {
+	for len(data) > 0 {
+		if len(data) < 7 || !bytes.Equal(data[0:4], []byte("8BIM")) {
+			return nil, errors.New("iptc: invalid image resource block")
+		}
+		resourceID := binary.BigEndian.Uint16(data[4:6])
+
+		// pascal string name, padded to even length
+		nameLength := 1 + int(data[6])
+		nameLength += nameLength % 2
+		pos := 6 + nameLength
+		if pos+4 > len(data) {
+			return nil, errors.New("iptc: image resource block too short")
+		}
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		pos += 4
+		if size < 0 || pos+size > len(data) {
+			return nil, errors.New("iptc: image resource block too short")
+		}
+		if resourceID == id {
+			return data[pos : pos+size], nil
+		}
+
+		pos += size + size%2
+		if pos > len(data) {
+			break
+		}
+		data = data[pos:]
+	}
+	return nil, errNoIptc
+}
+
+// parseIptc parses IPTC-IIM datasets. Values are converted to UTF-8 from
+// Latin-1 unless UTF-8 is declared, or they are valid UTF-8 already.
+func parseIptc(data []byte) (iptcMetadata, error) {
+	metadata := make(iptcMetadata)
+	isUTF8 := false
+	for len(data) > 0 {
+		if data[0] != 0x1c {
+			// trailing padding
+			break
+		}
+		if len(data) < 5 {
+			return nil, errors.New("iptc: dataset too short")
+		}
+		dataset := iptcDataset{data[1], data[2]}
+		length := int(binary.BigEndian.Uint16(data[3:5]))
+		pos := 5
+		if length&0x8000 != 0 {
+			// extended dataset; length is stored in the following bytes
+			count := length & 0x7fff
+			if count > 4 || pos+count > len(data) {
+				return nil, errors.New("iptc: invalid extended dataset")
+			}
+			length = 0
+			for _, b := range data[pos : pos+count] {
+				length = length<<8 | int(b)
+			}
+			pos += count
+		}
+		if length < 0 || pos+length > len(data) {
+			return nil, errors.New("iptc: dataset too short")
+		}
+		value := data[pos : pos+length]
+		data = data[pos+length:]
+
+		if dataset == iptcCodedCharacterSet {
+			isUTF8 = bytes.Equal(value, utf8Escape)
+			continue
+		}
+		if dataset.record != 2 {
+			continue
+		}
+		text := strings.TrimSpace(decodeIptcString(value, isUTF8))
+		if text != "" {
+			metadata[dataset] = append(metadata[dataset], text)
+		}
+	}
+	return metadata, nil
+}
+
+func decodeIptcString(value []byte, isUTF8 bool) string {
+	if isUTF8 || utf8.Valid(value) {
+		return string(value)
+	}
+	// Latin-1 maps directly onto first 256 code points
+	runes := make([]rune, len(value))
+	for i, b := range value {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
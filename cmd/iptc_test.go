@@ -0,0 +1,127 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func mkIptcDataset(dataset iptcDataset, value string) []byte {
+	return append([]byte{0x1c, dataset.record, dataset.dataset, byte(len(value) >> 8), byte(len(value))}, value...)
+}
+
+// mkJpegWithIptc returns minimal jpeg with IPTC in Photoshop APP13 segment,
+// preceded by another image resource.
+func mkJpegWithIptc(datasets ...[]byte) []byte {
+	iptc := bytes.Join(datasets, nil)
+
+	resources := []byte("8BIM\x04\x0c\x00\x00\x00\x00\x00\x03abc\x00") // thumbnail, padded
+	resources = append(resources, "8BIM\x04\x04\x04name\x00"...)
+	resources = append(resources, byte(len(iptc)>>24), byte(len(iptc)>>16), byte(len(iptc)>>8), byte(len(iptc)))
+	resources = append(resources, iptc...)
+
+	payload := append(append([]byte(nil), jpegPhotoshopHeader...), resources...)
+	length := len(payload) + 2
+	data := []byte{0xff, 0xd8, 0xff, jpegAPP13, byte(length >> 8), byte(length)}
+	data = append(data, payload...)
+	return append(data, 0xff, jpegEOI)
+}
+
+func TestReadJpegIptc(t *testing.T) {
+	data := mkJpegWithIptc(
+		mkIptcDataset(iptcDataset{2, 0}, "\x00\x04"),
+		mkIptcDataset(iptcKeywords, "Zagreb"),
+		mkIptcDataset(iptcKeywords, "Z\xfcrich"), // Latin-1
+		mkIptcDataset(iptcCaption, "Main square"),
+		mkIptcDataset(iptcCity, "Zagreb"),
+		mkIptcDataset(iptcCountry, "Croatia"),
+	)
+
+	iptc, err := readJpegIptc(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]string{
+		metadataCaption: "Main square",
+		metadataCity:    "Zagreb",
+		metadataCountry: "Croatia",
+	}
+	if got := iptc.metadata(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected metadata: %v", got)
+	}
+	if got := iptc.keywords(); !reflect.DeepEqual(got, []string{"Zagreb", "Zürich"}) {
+		t.Errorf("unexpected keywords: %v", got)
+	}
+
+	utf8 := mkJpegWithIptc(
+		mkIptcDataset(iptcCodedCharacterSet, "\x1b%G"),
+		mkIptcDataset(iptcCity, "Jelačić"),
+	)
+	if iptc, err = readJpegIptc(bytes.NewReader(utf8)); err != nil || iptc.metadata()[metadataCity] != "Jelačić" {
+		t.Errorf("unexpected metadata: %v (%v)", iptc, err)
+	}
+
+	if _, err := readJpegIptc(bytes.NewReader(mkJpegWithXmp(embeddedXmp))); err != errNoIptc {
+		t.Errorf("expected errNoIptc, got: %v", err)
+	}
+}
+
+func TestIptcMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iptc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "agency.jpg")
+	data := mkJpegWithIptc(
+		mkIptcDataset(iptcCity, "Split"),
+		mkIptcDataset(iptcKeywords, "sea"),
+		mkIptcDataset(iptcKeywords, "Split, Croatia"),
+	)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// file has no exif, but IPTC is still read; keywords are merged with
+	// those of XMP, and keep commas
+	file := &fileinfo{path: path, info: mkInfo(path)}
+	readIptcMetadata(file)
+	storeXmpMetadata(file, &xmpMetadata{subject: []string{"SEA", "holiday"}})
+	if file.metadata[metadataCity] != "Split" || file.metadata[metadataKeywords] != "sea, Split, Croatia, holiday" {
+		t.Errorf("unexpected metadata: %v", file.metadata)
+	}
+	if !reflect.DeepEqual(file.keywords, []string{"sea", "Split, Croatia", "holiday"}) {
+		t.Errorf("unexpected keywords: %q", file.keywords)
+	}
+
+	defer func() { requiredKeywords = nil }()
+	requiredKeywords = []string{"croatia"}
+	if reason := filterReason(file); reason == "" {
+		t.Error("keyword with comma should not match its part")
+	}
+	requiredKeywords = []string{"split, croatia"}
+	if reason := filterReason(file); reason != "" {
+		t.Errorf("unexpected filter reason: %s", reason)
+	}
+	if got := mustParseTemplate(t, "{City}", true).format(file.time, file, 0); got != "Split" {
+		t.Errorf("unexpected directory: %s", got)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// jpegFileTypes are extensions of JPEG files, which may carry XMP and IPTC
+// in addition to exif.
+var jpegFileTypes = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+}
+
+const (
+	jpegAPP1 = 0xe1
+	jpegSOS  = 0xda
+	jpegEOI  = 0xd9
+)
+
+var jpegExifHeader = []byte("Exif\x00\x00")
+
+// jpegSegment is a marker segment from the header of JPEG file.
+type jpegSegment struct {
+	marker byte
+	offset int64 // offset of the payload
+	length int64 // length of the payload
+}
+
+// readJpegSegments returns all marker segments preceding image data.
+func readJpegSegments(r io.ReaderAt) ([]jpegSegment, error) {
+	buf := make([]byte, 4)
+	if _, err := r.ReadAt(buf[:2], 0); err != nil {
+		return nil, fmt.Errorf("jpeg: reading header: %s", err)
+	}
+	if buf[0] != 0xff || buf[1] != 0xd8 {
+		return nil, errors.New("jpeg: not a jpeg file")
+	}
+
+	var segments []jpegSegment
+	for offset := int64(2); ; {
+		// markers without payload may be the last bytes of the file
+		n, err := r.ReadAt(buf, offset)
+		if n < 2 {
+			return nil, fmt.Errorf("jpeg: reading segment at %d: %s", offset, err)
+		}
+		if buf[0] != 0xff {
+			return nil, fmt.Errorf("jpeg: invalid marker at %d", offset)
+		}
+		marker := buf[1]
+		switch {
+		case marker == 0xff:
+			// fill byte
+			offset++
+			continue
+		case marker == jpegSOS || marker == jpegEOI:
+			return segments, nil
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// markers without payload
+			offset += 2
+			continue
+		}
+
+		if n < 4 {
+			return nil, fmt.Errorf("jpeg: reading segment at %d: %s", offset, err)
+		}
+		length := int64(buf[2])<<8 | int64(buf[3])
+		if length < 2 {
+			return nil, fmt.Errorf("jpeg: invalid segment length at %d", offset)
+		}
+		segments = append(segments, jpegSegment{
+			marker: marker,
+			offset: offset + 4,
+			length: length - 2,
+		})
+		offset += 2 + length
+	}
+}
+
+// findJpegSegment returns the first segment with the marker whose payload
+// starts with the header.
+func findJpegSegment(r io.ReaderAt, segments []jpegSegment, marker byte, header []byte) (*jpegSegment, error) {
+	buf := make([]byte, len(header))
+	for i := range segments {
+		segment := &segments[i]
+		if segment.marker != marker || segment.length < int64(len(header)) {
+			continue
+		}
+		if _, err := r.ReadAt(buf, segment.offset); err != nil {
+			return nil, fmt.Errorf("jpeg: reading segment: %s", err)
+		}
+		if bytes.Equal(buf, header) {
+			return segment, nil
+		}
+	}
+	return nil, nil
+}
+
+// jpegExifReader returns reader positioned over TIFF structure stored in
+// APP1 segment of JPEG file.
+func jpegExifReader(r io.ReaderAt) (*io.SectionReader, error) {
+	segments, err := readJpegSegments(r)
+	if err != nil {
+		return nil, err
+	}
+	segment, err := findJpegSegment(r, segments, jpegAPP1, jpegExifHeader)
+	if err != nil {
+		return nil, err
+	} else if segment == nil {
+		return nil, errors.New("jpeg: no exif segment")
+	}
+	headerLength := int64(len(jpegExifHeader))
+	return io.NewSectionReader(r, segment.offset+headerLength, segment.length-headerLength), nil
+}
@@ -0,0 +1,105 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"math"
+	"sort"
+)
+
+// kdPoint is a point in three dimensional space.
+type kdPoint [3]float64
+
+// distance2 returns squared Euclidean distance between the points.
+func (this kdPoint) distance2(other kdPoint) float64 {
+	var sum float64
+	for i := range this {
+		d := this[i] - other[i]
+		sum += d * d
+	}
+	return sum
+}
+
+// kdItem is a point stored in k-d tree along with index of its value.
+type kdItem struct {
+	point kdPoint
+	index int
+}
+
+// kdTree finds nearest neighbours among fixed set of points. The tree is
+// stored implicitly: the root of any range of items is its middle item, with
+// items before it on one side of the splitting plane and those after it on
+// the other.
+type kdTree struct {
+	items []kdItem
+}
+
+// newKdTree builds tree of the points; nearest returns indexes into points.
+func newKdTree(points []kdPoint) *kdTree {
+	items := make([]kdItem, len(points))
+	for i, point := range points {
+		items[i] = kdItem{point, i}
+	}
+	buildKdTree(items, 0)
+	return &kdTree{items}
+}
+
+// buildKdTree arranges items so that the middle one splits them along the
+// axis of the depth, and recurses into both halves.
+func buildKdTree(items []kdItem, depth int) {
+	if len(items) <= 1 {
+		return
+	}
+	axis := depth % len(kdPoint{})
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].point[axis] < items[j].point[axis]
+	})
+	mid := len(items) / 2
+	buildKdTree(items[:mid], depth+1)
+	buildKdTree(items[mid+1:], depth+1)
+}
+
+// nearest returns index of the point nearest to q and squared distance to
+// it, or -1 if the tree is empty.
+func (this *kdTree) nearest(q kdPoint) (int, float64) {
+	best, bestDistance := -1, math.Inf(1)
+
+	var search func(lo, hi, depth int)
+	search = func(lo, hi, depth int) {
+		if lo >= hi {
+			return
+		}
+		mid := lo + (hi-lo)/2
+		item := &this.items[mid]
+		if d := q.distance2(item.point); d < bestDistance {
+			best, bestDistance = item.index, d
+		}
+
+		// search the side of the splitting plane containing q first, and the
+		// other side only if it may be closer than the best so far
+		axis := depth % len(q)
+		diff := q[axis] - item.point[axis]
+		near, far := [2]int{lo, mid}, [2]int{mid + 1, hi}
+		if diff > 0 {
+			near, far = far, near
+		}
+		search(near[0], near[1], depth+1)
+		if diff*diff < bestDistance {
+			search(far[0], far[1], depth+1)
+		}
+	}
+	search(0, len(this.items), 0)
+	return best, bestDistance
+}
@@ -0,0 +1,53 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestKdTree(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	randomPoint := func() kdPoint {
+		return kdPoint{random.Float64(), random.Float64(), random.Float64()}
+	}
+
+	if index, _ := newKdTree(nil).nearest(kdPoint{}); index != -1 {
+		t.Errorf("empty tree returned %d", index)
+	}
+
+	for _, size := range []int{1, 2, 3, 10, 1000} {
+		points := make([]kdPoint, size)
+		for i := range points {
+			points[i] = randomPoint()
+		}
+		tree := newKdTree(points)
+
+		for i := 0; i < 100; i++ {
+			q := randomPoint()
+			expected := 0
+			for j := range points {
+				if q.distance2(points[j]) < q.distance2(points[expected]) {
+					expected = j
+				}
+			}
+			index, distance := tree.nearest(q)
+			if index != expected || distance != q.distance2(points[expected]) {
+				t.Errorf("size %d: expected %d got %d", size, expected, index)
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// appleMakerNoteHeader starts maker notes of photos taken by Apple devices.
+// It is followed by version and byte order; value offsets are relative to
+// the start of the maker note.
+const appleMakerNoteHeader = "Apple iOS\x00"
+
+// appleContentIdentifierTag holds the identifier shared by still and video
+// of a Live Photo.
+const appleContentIdentifierTag = 0x0011
+
+// appleMakerNoteString returns the value of an ASCII tag of Apple maker note.
+func appleMakerNoteString(note []byte, tag uint16) (string, bool) {
+	const ifdOffset = 14
+	if len(note) < ifdOffset+2 || !bytes.HasPrefix(note, []byte(appleMakerNoteHeader)) {
+		return "", false
+	}
+	var order binary.ByteOrder
+	switch string(note[12:14]) {
+	case "MM":
+		order = binary.BigEndian
+	case "II":
+		order = binary.LittleEndian
+	default:
+		return "", false
+	}
+
+	count := int(order.Uint16(note[ifdOffset:]))
+	for i := 0; i < count; i++ {
+		start := ifdOffset + 2 + 12*i
+		if start+12 > len(note) {
+			return "", false
+		}
+		entry := note[start : start+12]
+		if order.Uint16(entry) != tag {
+			continue
+		}
+		if order.Uint16(entry[2:]) != 2 {
+			return "", false // not ASCII
+		}
+		size := int64(order.Uint32(entry[4:]))
+		value := entry[8:]
+		if size > 4 {
+			offset := int64(order.Uint32(entry[8:]))
+			if offset+size > int64(len(note)) {
+				return "", false
+			}
+			value = note[offset : offset+size]
+		} else {
+			value = value[:size]
+		}
+		result := strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+		return result, result != ""
+	}
+	return "", false
+}
+
+// isLivePhotoStill returns true for files which may be the still of a Live
+// Photo.
+func isLivePhotoStill(file *fileinfo) bool {
+	ext := file.mediaType()
+	return heifFileTypes[ext] || jpegFileTypes[ext]
+}
+
+// isLivePhotoVideo returns true for files which may be the video of a Live
+// Photo.
+func isLivePhotoVideo(file *fileinfo) bool {
+	return file.mediaType() == ".mov"
+}
+
+// pairLivePhotos groups still and video of Live Photos not sharing base
+// name, e.g. IMG_1234.HEIC and IMG_1234(1).MOV, by ContentIdentifier found
+// in their meta data. Those sharing base name are already grouped. The
+// still is preferred for the primary, so the video, which often lacks a
+// reliable date, is moved by the time of the still. Identifiers found on
+// more than one still or video, e.g. of a backup copy of the same Live
+// Photo, are ambiguous and not paired.
+func pairLivePhotos(files []*fileinfo) {
+	stills := make(map[string][]*fileinfo)
+	videos := make(map[string][]*fileinfo)
+	var ids []string
+	for _, file := range files {
+		id := file.metadata[metadataContentIdentifier]
+		still, video := isLivePhotoStill(file), isLivePhotoVideo(file)
+		if id == "" || (!still && !video) {
+			continue
+		}
+		if len(stills[id]) == 0 && len(videos[id]) == 0 {
+			ids = append(ids, id)
+		}
+		if still {
+			stills[id] = append(stills[id], file)
+		} else {
+			videos[id] = append(videos[id], file)
+		}
+	}
+
+	for _, id := range ids {
+		if len(stills[id]) != 1 || len(videos[id]) != 1 {
+			continue
+		}
+		still, video := stills[id][0], videos[id][0]
+		if video.group != nil && video.group == still.group {
+			continue
+		}
+		mergeCompanionGroups(still, video)
+		Info("\r%s: live photo video, handled together with %s\n", video.path, still.path)
+	}
+}
+
+// readContentIdentifier returns ContentIdentifier of Live Photo still or
+// video, or empty string if there is none.
+func readContentIdentifier(file *fileinfo) string {
+	is, err := os.Open(file.path)
+	if err != nil {
+		return ""
+	}
+	defer is.Close()
+
+	if isoMediaFileTypes[file.mediaType()] {
+		meta, err := decodeMp4(is, file.info.Size())
+		if err != nil {
+			return ""
+		}
+		return meta.Metadata()[metadataContentIdentifier]
+	}
+	x, err := decodeExif(is, file)
+	if err != nil {
+		return ""
+	}
+	return exifMetadata(x)[metadataContentIdentifier]
+}
+
+// findLivePhotoPartners links still and video of Live Photos, which share
+// directory and base name, unless their ContentIdentifier differs.
+func findLivePhotoPartners(files []*fileinfo) {
+	stills := make(map[string]*fileinfo)
+	for _, file := range files {
+		file.livePhoto = nil
+		if isLivePhotoStill(file) {
+			stills[strings.TrimSuffix(file.path, filepath.Ext(file.path))] = file
+		}
+	}
+
+	for _, file := range files {
+		if !isLivePhotoVideo(file) {
+			continue
+		}
+		still := stills[strings.TrimSuffix(file.path, filepath.Ext(file.path))]
+		if still == nil || still.livePhoto != nil {
+			continue
+		}
+		stillID, videoID := readContentIdentifier(still), readContentIdentifier(file)
+		if stillID != "" && videoID != "" && stillID != videoID {
+			continue
+		}
+		still.livePhoto = file
+		file.livePhoto = still
+	}
+}
+
+// deleteLivePhotoDuplicates deletes stills and videos of Live Photos found
+// to be duplicates. A pair is deleted only when both its files duplicate
+// the same kept pair, so no pair is left with half of it.
+func deleteLivePhotoDuplicates(files []*fileinfo) error {
+	for _, still := range files {
+		video := still.livePhoto
+		if video == nil || !isLivePhotoStill(still) || (still.duplicateOf == nil && video.duplicateOf == nil) {
+			continue
+		}
+
+		if still.duplicateOf != nil && video.duplicateOf != nil {
+			kept := still.duplicateOf.livePhoto
+			if kept != nil && (kept == video.duplicateOf || kept.duplicateOf == video.duplicateOf) {
+				for _, file := range []*fileinfo{still, video} {
+					if err := deleteFile(file.path); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+		}
+		for _, file := range []*fileinfo{still, video} {
+			if file.duplicateOf != nil {
+				Info("%s: duplicate of %s, kept with its live photo pair\n", file.path, file.duplicateOf.path)
+			}
+		}
+	}
+	return nil
+}
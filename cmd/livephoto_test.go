@@ -0,0 +1,162 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mkAppleMakerNote returns big endian Apple maker note with a single ASCII
+// tag.
+func mkAppleMakerNote(tag uint16, value string) []byte {
+	note := []byte(appleMakerNoteHeader + "\x00\x01MM")
+	note = append(note, 0, 1)
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], tag)
+	binary.BigEndian.PutUint16(entry[2:], 2)
+	binary.BigEndian.PutUint32(entry[4:], uint32(len(value)+1))
+	binary.BigEndian.PutUint32(entry[8:], uint32(len(note)+12))
+	note = append(note, entry...)
+	return append(note, value+"\x00"...)
+}
+
+func TestAppleMakerNoteString(t *testing.T) {
+	const id = "6E8F8F4A-2B63-4B8A-9C2A-5A1D1E2F3A4B"
+	note := mkAppleMakerNote(appleContentIdentifierTag, id)
+
+	if value, ok := appleMakerNoteString(note, appleContentIdentifierTag); !ok || value != id {
+		t.Errorf("unexpected value: %s %v", value, ok)
+	}
+	if value, ok := appleMakerNoteString(note, 0x0008); ok {
+		t.Errorf("unexpected value of missing tag: %s", value)
+	}
+	if value, ok := appleMakerNoteString(note[:len(note)-10], appleContentIdentifierTag); ok {
+		t.Errorf("unexpected value of truncated note: %s", value)
+	}
+	other := append([]byte("Nikon\x00"), note[6:]...)
+	if value, ok := appleMakerNoteString(other, appleContentIdentifierTag); ok {
+		t.Errorf("unexpected value of other maker note: %s", value)
+	}
+}
+
+func TestMp4ContentIdentifier(t *testing.T) {
+	meta := &mp4Metadata{keys: map[string]string{
+		appleContentIdentifierKey: "6E8F8F4A",
+	}}
+	if value := meta.Metadata()[metadataContentIdentifier]; value != "6E8F8F4A" {
+		t.Errorf("unexpected identifier: %s", value)
+	}
+}
+
+func TestPairLivePhotos(t *testing.T) {
+	mkFile := func(path, id string) *fileinfo {
+		file := &fileinfo{path: path}
+		if id != "" {
+			file.metadata = map[string]string{metadataContentIdentifier: id}
+		}
+		return file
+	}
+	still := mkFile("src/IMG_1234.HEIC", "A")
+	video := mkFile("src/IMG_1234(1).MOV", "A")
+	thumb := mkFile("src/IMG_1234(1).THM", "")
+	other := mkFile("src/IMG_5678.MOV", "B")
+	files := []*fileinfo{video, thumb, still, other}
+
+	groupCompanions(files)
+	pairLivePhotos(files)
+
+	group := still.group
+	if group == nil || group.primary != still || video.group != group || thumb.group != group {
+		t.Fatalf("unexpected group: %v", group)
+	}
+	if len(group.files) != 2 || group.files[1] != video || len(group.companions) != 1 {
+		t.Errorf("unexpected group members: %v %v", group.files, group.companions)
+	}
+	if other.group != nil {
+		t.Errorf("unexpected group of unpaired video: %v", other.group)
+	}
+
+	// copies of the same Live Photo in a backup and a phone dump are
+	// ambiguous and are not paired across directories
+	backupStill := mkFile("backup/IMG_1111.HEIC", "C")
+	backupVideo := mkFile("backup/IMG_1111(1).MOV", "C")
+	phoneStill := mkFile("phone/IMG_1111.HEIC", "C")
+	phoneVideo := mkFile("phone/IMG_1111(1).MOV", "C")
+	files = []*fileinfo{backupStill, backupVideo, phoneStill, phoneVideo}
+	groupCompanions(files)
+	pairLivePhotos(files)
+	for _, file := range files {
+		if file.group != nil {
+			t.Errorf("%s: unexpected group: %v", file.path, file.group.files)
+		}
+	}
+}
+
+func TestDedupeLivePhotos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "photo-cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, contents := range map[string]string{
+		"a/IMG_1234.HEIC": "still",
+		"a/IMG_1234.MOV":  "video",
+		// still is a duplicate, but video is not
+		"b/IMG_1234.HEIC": "still",
+		"b/IMG_1234.MOV":  "other",
+		// the whole pair is a duplicate
+		"c/IMG_1234.HEIC": "still",
+		"c/IMG_1234.MOV":  "video",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	OS := initMockOs()
+	paths := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")}
+	if err := dedupe(paths); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if OS.remove.called != 2 || OS.remove.path != filepath.Join(dir, "c/IMG_1234.MOV") {
+		t.Errorf("unexpected remove (%d): %s", OS.remove.called, OS.remove.path)
+	}
+
+	// empty files are identical only with the flag, and still deleted only
+	// in pairs
+	defer func() { emptyFilesAreIdentical = false }()
+	emptyFilesAreIdentical = true
+	for _, name := range []string{"a/IMG_5678.HEIC", "b/IMG_5678.HEIC", "b/IMG_5678.MOV"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	OS = initMockOs()
+	if err := dedupe(paths); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if OS.remove.called != 2 || OS.remove.path != filepath.Join(dir, "c/IMG_1234.MOV") {
+		t.Errorf("unexpected remove (%d): %s", OS.remove.called, OS.remove.path)
+	}
+}
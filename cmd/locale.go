@@ -0,0 +1,196 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var localeName string
+
+// directoryLocale gives month and weekday names used in directory and name
+// formats. When nil, English names are used.
+var directoryLocale *timeLocale
+
+// timeLocale holds month and weekday names of a language, January and
+// Sunday first.
+type timeLocale struct {
+	months        [12]string
+	shortMonths   [12]string
+	weekdays      [7]string
+	shortWeekdays [7]string
+}
+
+// timeLocales are built-in locales, by language code.
+var timeLocales = map[string]*timeLocale{
+	"en": {
+		[12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		[12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		[7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		[7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	},
+	"de": {
+		[12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		[12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+		[7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		[7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+	},
+	"fr": {
+		[12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		[12]string{"janv", "févr", "mars", "avr", "mai", "juin", "juil", "août", "sept", "oct", "nov", "déc"},
+		[7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		[7]string{"dim", "lun", "mar", "mer", "jeu", "ven", "sam"},
+	},
+	"es": {
+		[12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		[12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sep", "oct", "nov", "dic"},
+		[7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		[7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+	},
+	"it": {
+		[12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		[12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		[7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		[7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+	},
+	"pt": {
+		[12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		[12]string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+		[7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		[7]string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+	},
+	"nl": {
+		[12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		[12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		[7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		[7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+	},
+	"sv": {
+		[12]string{"januari", "februari", "mars", "april", "maj", "juni", "juli", "augusti", "september", "oktober", "november", "december"},
+		[12]string{"jan", "feb", "mar", "apr", "maj", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		[7]string{"söndag", "måndag", "tisdag", "onsdag", "torsdag", "fredag", "lördag"},
+		[7]string{"sön", "mån", "tis", "ons", "tor", "fre", "lör"},
+	},
+	"da": {
+		[12]string{"januar", "februar", "marts", "april", "maj", "juni", "juli", "august", "september", "oktober", "november", "december"},
+		[12]string{"jan", "feb", "mar", "apr", "maj", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		[7]string{"søndag", "mandag", "tirsdag", "onsdag", "torsdag", "fredag", "lørdag"},
+		[7]string{"søn", "man", "tir", "ons", "tor", "fre", "lør"},
+	},
+	"nb": {
+		[12]string{"januar", "februar", "mars", "april", "mai", "juni", "juli", "august", "september", "oktober", "november", "desember"},
+		[12]string{"jan", "feb", "mar", "apr", "mai", "jun", "jul", "aug", "sep", "okt", "nov", "des"},
+		[7]string{"søndag", "mandag", "tirsdag", "onsdag", "torsdag", "fredag", "lørdag"},
+		[7]string{"søn", "man", "tir", "ons", "tor", "fre", "lør"},
+	},
+	"fi": {
+		[12]string{"tammikuu", "helmikuu", "maaliskuu", "huhtikuu", "toukokuu", "kesäkuu", "heinäkuu", "elokuu", "syyskuu", "lokakuu", "marraskuu", "joulukuu"},
+		[12]string{"tammi", "helmi", "maalis", "huhti", "touko", "kesä", "heinä", "elo", "syys", "loka", "marras", "joulu"},
+		[7]string{"sunnuntai", "maanantai", "tiistai", "keskiviikko", "torstai", "perjantai", "lauantai"},
+		[7]string{"su", "ma", "ti", "ke", "to", "pe", "la"},
+	},
+	"pl": {
+		[12]string{"styczeń", "luty", "marzec", "kwiecień", "maj", "czerwiec", "lipiec", "sierpień", "wrzesień", "październik", "listopad", "grudzień"},
+		[12]string{"sty", "lut", "mar", "kwi", "maj", "cze", "lip", "sie", "wrz", "paź", "lis", "gru"},
+		[7]string{"niedziela", "poniedziałek", "wtorek", "środa", "czwartek", "piątek", "sobota"},
+		[7]string{"nie", "pon", "wt", "śr", "czw", "pt", "sob"},
+	},
+	"cs": {
+		[12]string{"leden", "únor", "březen", "duben", "květen", "červen", "červenec", "srpen", "září", "říjen", "listopad", "prosinec"},
+		[12]string{"led", "úno", "bře", "dub", "kvě", "čvn", "čvc", "srp", "zář", "říj", "lis", "pro"},
+		[7]string{"neděle", "pondělí", "úterý", "středa", "čtvrtek", "pátek", "sobota"},
+		[7]string{"ne", "po", "út", "st", "čt", "pá", "so"},
+	},
+	"hu": {
+		[12]string{"január", "február", "március", "április", "május", "június", "július", "augusztus", "szeptember", "október", "november", "december"},
+		[12]string{"jan", "febr", "márc", "ápr", "máj", "jún", "júl", "aug", "szept", "okt", "nov", "dec"},
+		[7]string{"vasárnap", "hétfő", "kedd", "szerda", "csütörtök", "péntek", "szombat"},
+		[7]string{"V", "H", "K", "Sze", "Cs", "P", "Szo"},
+	},
+	"hr": {
+		[12]string{"siječanj", "veljača", "ožujak", "travanj", "svibanj", "lipanj", "srpanj", "kolovoz", "rujan", "listopad", "studeni", "prosinac"},
+		[12]string{"sij", "velj", "ožu", "tra", "svi", "lip", "srp", "kol", "ruj", "lis", "stu", "pro"},
+		[7]string{"nedjelja", "ponedjeljak", "utorak", "srijeda", "četvrtak", "petak", "subota"},
+		[7]string{"ned", "pon", "uto", "sri", "čet", "pet", "sub"},
+	},
+	"sr": {
+		[12]string{"januar", "februar", "mart", "april", "maj", "jun", "jul", "avgust", "septembar", "oktobar", "novembar", "decembar"},
+		[12]string{"jan", "feb", "mar", "apr", "maj", "jun", "jul", "avg", "sep", "okt", "nov", "dec"},
+		[7]string{"nedelja", "ponedeljak", "utorak", "sreda", "četvrtak", "petak", "subota"},
+		[7]string{"ned", "pon", "uto", "sre", "čet", "pet", "sub"},
+	},
+}
+
+// timeLocaleAliases map other codes onto built-in locales.
+var timeLocaleAliases = map[string]string{
+	"no": "nb",
+	"nn": "nb",
+	"sh": "sr",
+}
+
+// findTimeLocale returns built-in locale for language code, which may be
+// followed by country and encoding, e.g. de, de_AT or de_DE.UTF-8.
+func findTimeLocale(name string) (*timeLocale, error) {
+	language := strings.ToLower(name)
+	if i := strings.IndexAny(language, "_-.@"); i >= 0 {
+		language = language[:i]
+	}
+	if alias, ok := timeLocaleAliases[language]; ok {
+		language = alias
+	}
+	if locale, ok := timeLocales[language]; ok {
+		return locale, nil
+	}
+
+	var names []string
+	for name := range timeLocales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown locale '%s'; use one of %s", name, strings.Join(names, ", "))
+}
+
+// initLocale parses --locale flag.
+func initLocale() error {
+	directoryLocale = nil
+	if localeName == "" {
+		return nil
+	}
+
+	var err error
+	if directoryLocale, err = findTimeLocale(localeName); err != nil {
+		return fmt.Errorf("--locale: %s", err)
+	}
+	return nil
+}
+
+// name returns localized name of month or weekday of time t for tokens
+// mmmm, mmm, dddd and ddd, or false for other tokens.
+func (this *timeLocale) name(token string, t time.Time) (string, bool) {
+	switch token {
+	case "mmmm":
+		return this.months[t.Month()-1], true
+	case "mmm":
+		return this.shortMonths[t.Month()-1], true
+	case "dddd":
+		return this.weekdays[t.Weekday()], true
+	case "ddd":
+		return this.shortWeekdays[t.Weekday()], true
+	}
+	return "", false
+}
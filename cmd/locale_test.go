@@ -0,0 +1,128 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindTimeLocale(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		err      string
+	}{
+		{"de", "de", ""},
+		{"de_AT", "de", ""},
+		{"fr-CA", "fr", ""},
+		{"SR_RS.UTF-8", "sr", ""},
+		{"sr_RS@latin", "sr", ""},
+		{"no", "nb", ""},
+		{"xx", "", "unknown locale 'xx'; use one of cs, da, de, en"},
+		{"", "", "unknown locale ''"},
+	}
+
+	for _, test := range tests {
+		locale, err := findTimeLocale(test.name)
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("%s: expected error:%s got:%v", test.name, test.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		} else if locale != timeLocales[test.expected] {
+			t.Errorf("%s: expected locale %s", test.name, test.expected)
+		}
+	}
+}
+
+func TestTimeLocales(t *testing.T) {
+	for language, locale := range timeLocales {
+		months := make(map[string]bool)
+		for i := range locale.months {
+			if locale.months[i] == "" || locale.shortMonths[i] == "" {
+				t.Errorf("%s: missing name of month %d", language, i+1)
+			}
+			months[locale.shortMonths[i]] = true
+		}
+		if len(months) != 12 {
+			t.Errorf("%s: short month names are not unique", language)
+		}
+		weekdays := make(map[string]bool)
+		for i := range locale.weekdays {
+			if locale.weekdays[i] == "" || locale.shortWeekdays[i] == "" {
+				t.Errorf("%s: missing name of weekday %d", language, i)
+			}
+			weekdays[locale.shortWeekdays[i]] = true
+		}
+		if len(weekdays) != 7 {
+			t.Errorf("%s: short weekday names are not unique", language)
+		}
+	}
+
+	// English locale matches Go names
+	en := timeLocales["en"]
+	for day := 0; day < 7; day++ {
+		d := time.Date(2018, time.Month(day+1), day+1, 0, 0, 0, 0, time.UTC)
+		for _, token := range []string{"mmmm", "mmm", "dddd", "ddd"} {
+			format, _ := parseTimeFormat(token)
+			if got := format.FormatLocale(d, en); got != format.Format(d) {
+				t.Errorf("%s: expected:%s got:%s", token, format.Format(d), got)
+			}
+		}
+	}
+}
+
+func TestLocalizedDirectory(t *testing.T) {
+	defer func() { directoryLocale = nil }()
+
+	tests := []struct {
+		locale   string
+		format   string
+		expected string
+	}{
+		{"en", "yyyy/mm mmmm", "2018/03 March"},
+		{"de", "yyyy/mm mmmm", "2018/03 März"},
+		{"fr", "yyyy/mm mmmm", "2018/03 mars"},
+		{"sr", "yyyy/mm mmm/dd dddd", "2018/03 mar/04 nedelja"},
+		{"hr", "yyyy/{mmmm}/{ddd}", "2018/ožujak/ned"},
+		{"pl", "yyyy-mm-dd ddd", "2018-03-04 nie"},
+		{"it", "yyyy/'mmmm' mmmm", "2018/mmmm marzo"},
+	}
+
+	file := &fileinfo{path: "/src/IMG_0001.jpg"}
+	taken := time.Date(2018, 3, 4, 12, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		localeName = test.locale
+		if err := initLocale(); err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.locale, err)
+		}
+		if got := mustParseTemplate(t, test.format, true).format(taken, file, 0); got != test.expected {
+			t.Errorf("%s %s: expected:%s got:%s", test.locale, test.format, test.expected, got)
+		}
+	}
+	localeName = "en"
+
+	template, err := parseTemplate("{yyyy}-{mmmm}_{name}.{ext}", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	directoryLocale = timeLocales["de"]
+	if got := template.format(taken, file, 1); got != "2018-März_IMG_0001.jpg" {
+		t.Errorf("unexpected name: %s", got)
+	}
+}
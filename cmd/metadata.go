@@ -0,0 +1,97 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Keys of fileinfo.metadata. Names follow exif, XMP and IPTC fields they are
+// read from, and are used as {placeholders} in directory format.
+const (
+	metadataMake        = "Make"
+	metadataModel       = "Model"
+	metadataSerial      = "BodySerialNumber"
+	metadataLens        = "LensModel"
+	metadataDescription = "Description"
+	metadataRating      = "Rating"
+	metadataKeywords    = "Keywords"
+	metadataCaption     = "Caption"
+	metadataHeadline    = "Headline"
+	metadataByline      = "Byline"
+	metadataCity        = "City"
+	metadataState       = "State"
+	metadataCountry     = "Country"
+	// metadataContentIdentifier links still and video of a Live Photo
+	metadataContentIdentifier = "ContentIdentifier"
+)
+
+// embeddedMetadata is meta data stored in chunks of PNG, WebP and GIF files.
+type embeddedMetadata struct {
+	exif         []byte // TIFF structure, as in jpeg APP1 segment
+	xmp          []byte
+	creationTime string // PNG "Creation Time" text
+}
+
+// setMetadata stores value into file.metadata unless already set.
+func (this *fileinfo) setMetadata(key, value string) {
+	if value == "" {
+		return
+	}
+	if this.metadata == nil {
+		this.metadata = make(map[string]string)
+	}
+	if _, ok := this.metadata[key]; !ok {
+		this.metadata[key] = value
+	}
+}
+
+// addKeywords merges keywords into those of the file, ignoring case.
+func (this *fileinfo) addKeywords(keywords []string) {
+	for _, keyword := range keywords {
+		keyword = strings.TrimSpace(keyword)
+		duplicate := keyword == ""
+		for _, existing := range this.keywords {
+			duplicate = duplicate || strings.EqualFold(existing, keyword)
+		}
+		if !duplicate {
+			this.keywords = append(this.keywords, keyword)
+		}
+	}
+	if len(this.keywords) > 0 {
+		if this.metadata == nil {
+			this.metadata = make(map[string]string)
+		}
+		this.metadata[metadataKeywords] = strings.Join(this.keywords, ", ")
+	}
+}
+
+// describeMetadata lists meta data of the file as key=value pairs, for
+// reports.
+func describeMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", key, metadata[key]))
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,157 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// EBML element IDs, with length marker bits included as usual.
+const (
+	ebmlHeader      = 0x1a45dfa3
+	ebmlSegment     = 0x18538067
+	ebmlInfo        = 0x1549a966
+	ebmlDateUTC     = 0x4461
+	ebmlCluster     = 0x1f43b675
+	ebmlUnknownSize = -1
+)
+
+// mkvEpoch is the origin of Matroska DateUTC, which counts nanoseconds.
+var mkvEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ebmlElement describes position of a single EBML element.
+type ebmlElement struct {
+	id   uint32
+	data int64 // offset of the payload
+	size int64 // ebmlUnknownSize for streamed elements
+}
+
+// readEbmlVint reads variable length integer at offset; returns the value
+// with or without the length marker and the number of bytes read.
+func readEbmlVint(r io.ReaderAt, offset int64, keepMarker bool) (int64, int, error) {
+	buf := make([]byte, 8)
+	if _, err := r.ReadAt(buf[:1], offset); err != nil {
+		return 0, 0, err
+	}
+	length := 1
+	for mask := byte(0x80); length <= 8 && buf[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, fmt.Errorf("mkv: invalid integer at %d", offset)
+	}
+	if _, err := r.ReadAt(buf[1:length], offset+1); err != nil {
+		return 0, 0, err
+	}
+
+	value := int64(buf[0])
+	if !keepMarker {
+		value &= 0xff >> uint(length)
+	}
+	allOnes := value == 0xff>>uint(length)
+	for _, b := range buf[1:length] {
+		value = value<<8 | int64(b)
+		allOnes = allOnes && b == 0xff
+	}
+	if !keepMarker && allOnes {
+		return ebmlUnknownSize, length, nil
+	}
+	return value, length, nil
+}
+
+// readEbmlElement reads element header at offset.
+func readEbmlElement(r io.ReaderAt, offset int64) (*ebmlElement, error) {
+	id, idLength, err := readEbmlVint(r, offset, true)
+	if err != nil {
+		return nil, err
+	}
+	size, sizeLength, err := readEbmlVint(r, offset+int64(idLength), false)
+	if err != nil {
+		return nil, err
+	}
+	return &ebmlElement{
+		id:   uint32(id),
+		data: offset + int64(idLength+sizeLength),
+		size: size,
+	}, nil
+}
+
+// findEbmlElement returns the first child with the id among children
+// between start and end. Search stops at the first element of unknown size
+// which is not the one searched for.
+func findEbmlElement(r io.ReaderAt, start, end int64, id uint32) (*ebmlElement, error) {
+	for offset := start; offset < end; {
+		element, err := readEbmlElement(r, offset)
+		if err != nil {
+			return nil, fmt.Errorf("mkv: reading element at %d: %s", offset, err)
+		}
+		if element.id == id {
+			return element, nil
+		}
+		if element.size == ebmlUnknownSize || element.id == ebmlCluster {
+			// media data follows; Info precedes it
+			break
+		}
+		offset = element.data + element.size
+	}
+	return nil, nil
+}
+
+// decodeMkvTimes reads DateUTC from segment info of Matroska and WebM
+// files.
+func decodeMkvTimes(r io.ReaderAt, size int64) ([]metadataTime, error) {
+	header, err := readEbmlElement(r, 0)
+	if err != nil || header.id != ebmlHeader {
+		return nil, errors.New("mkv: not a matroska file")
+	}
+
+	segment, err := findEbmlElement(r, header.data+header.size, size, ebmlSegment)
+	if err != nil {
+		return nil, err
+	} else if segment == nil {
+		return nil, errors.New("mkv: no segment")
+	}
+	end := size
+	if segment.size != ebmlUnknownSize && segment.data+segment.size < end {
+		end = segment.data + segment.size
+	}
+
+	info, err := findEbmlElement(r, segment.data, end, ebmlInfo)
+	if err != nil || info == nil || info.size == ebmlUnknownSize {
+		return nil, err
+	}
+	date, err := findEbmlElement(r, info.data, info.data+info.size, ebmlDateUTC)
+	if err != nil || date == nil {
+		return nil, err
+	}
+	if date.size != 8 {
+		return nil, fmt.Errorf("mkv: invalid DateUTC size %d", date.size)
+	}
+	buf := make([]byte, 8)
+	if _, err := r.ReadAt(buf, date.data); err != nil {
+		return nil, fmt.Errorf("mkv: reading DateUTC: %s", err)
+	}
+	nanoseconds := int64(binary.BigEndian.Uint64(buf))
+	if nanoseconds == 0 {
+		// muxers write zero when the date is not set
+		return nil, nil
+	}
+	t := mkvEpoch.Add(time.Duration(nanoseconds))
+	return []metadataTime{{field: "DateUTC", time: t.In(captureZone())}}, nil
+}
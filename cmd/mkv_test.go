@@ -0,0 +1,74 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func mkEbmlElement(id []byte, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(data)))
+	size[0] = 0x01 // 8 byte size
+	return append(append(append([]byte(nil), id...), size...), data...)
+}
+
+func mkMkv(segment ...[]byte) []byte {
+	header := mkEbmlElement([]byte{0x1a, 0x45, 0xdf, 0xa3}, mkEbmlElement([]byte{0x42, 0x82}, []byte("webm")))
+	return append(header, mkEbmlElement([]byte{0x18, 0x53, 0x80, 0x67}, segment...)...)
+}
+
+func TestDecodeMkvTimes(t *testing.T) {
+	captureTime := time.Date(2019, 3, 5, 10, 20, 30, 0, time.UTC)
+	date := make([]byte, 8)
+	binary.BigEndian.PutUint64(date, uint64(captureTime.Sub(mkvEpoch)))
+
+	seekHead := mkEbmlElement([]byte{0x11, 0x4d, 0x9b, 0x74}, make([]byte, 10))
+	info := mkEbmlElement([]byte{0x15, 0x49, 0xa9, 0x66},
+		mkEbmlElement([]byte{0x2a, 0xd7, 0xb1}, []byte{0x0f, 0x42, 0x40}),
+		mkEbmlElement([]byte{0x44, 0x61}, date))
+	data := mkMkv(seekHead, info)
+
+	times, err := decodeMkvTimes(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(times) != 1 || !times[0].time.Equal(captureTime) {
+		t.Errorf("unexpected times: %v", times)
+	}
+
+	// streamed WebM: cluster of unknown size, no DateUTC
+	cluster := append([]byte{0x1f, 0x43, 0xb6, 0x75, 0xff}, make([]byte, 20)...)
+	data = mkMkv(mkEbmlElement([]byte{0x15, 0x49, 0xa9, 0x66}), cluster)
+	if times, err := decodeMkvTimes(bytes.NewReader(data), int64(len(data))); err != nil || len(times) != 0 {
+		t.Errorf("unexpected result: %v %v", times, err)
+	}
+
+	// DateUTC of zero is not set
+	info = mkEbmlElement([]byte{0x15, 0x49, 0xa9, 0x66}, mkEbmlElement([]byte{0x44, 0x61}, make([]byte, 8)))
+	data = mkMkv(info)
+	if times, err := decodeMkvTimes(bytes.NewReader(data), int64(len(data))); err != nil || len(times) != 0 {
+		t.Errorf("unexpected result for zero DateUTC: %v %v", times, err)
+	}
+
+	data = []byte("RIFF\x00\x00\x00\x00AVI ")
+	if _, err := decodeMkvTimes(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// mp4EpochOffset is the number of seconds between the start of the
+// QuickTime/ISO-BMFF time scale (1904-01-01 UTC) and the Unix epoch. All
+// creation and modification times in mvhd and tkhd boxes are seconds since
+// 1904.
+const mp4EpochOffset = 2082844800
+
+// Apple devices write local capture time with offset into this key.
+const appleCreationDateKey = "com.apple.quicktime.creationdate"
+
+// Apple devices identify themselves using these keys.
+const (
+	appleMakeKey  = "com.apple.quicktime.make"
+	appleModelKey = "com.apple.quicktime.model"
+)
+
+// Apple devices link video of a Live Photo to its still using this key.
+const appleContentIdentifierKey = "com.apple.quicktime.content.identifier"
+
+var appleCreationDateLayouts = []string{
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+}
+
+var errNoMp4Time = errors.New("mp4: no creation time")
+
+// mp4TopLevelBoxes lists box types which may start a valid ISO-BMFF or
+// QuickTime file.
+var mp4TopLevelBoxes = map[string]bool{
+	"ftyp": true,
+	"moov": true,
+	"mdat": true,
+	"free": true,
+	"skip": true,
+	"wide": true,
+	"pnot": true,
+}
+
+// mp4Box describes position of a single box (atom) within the file.
+type mp4Box struct {
+	typ    string
+	offset int64 // offset of the box header
+	data   int64 // offset of the box payload
+	end    int64 // offset of the first byte after the box
+}
+
+// mp4Metadata holds values extracted from ISO-BMFF (mp4, mov, 3gp) files.
+type mp4Metadata struct {
+	movieCreation time.Time
+	trackCreation time.Time
+	keys          map[string]string
+}
+
+// Metadata returns fields identifying the device which recorded the video,
+// and the Live Photo it belongs to.
+func (m *mp4Metadata) Metadata() map[string]string {
+	metadata := make(map[string]string)
+	if value := m.keys[appleMakeKey]; value != "" {
+		metadata[metadataMake] = value
+	}
+	if value := m.keys[appleModelKey]; value != "" {
+		metadata[metadataModel] = value
+	}
+	if value := m.keys[appleContentIdentifierKey]; value != "" {
+		metadata[metadataContentIdentifier] = value
+	}
+	return metadata
+}
+
+// DateTime returns the best capture time found in the file. Apple's creation
+// date metadata is preferred as it carries the local time and offset, or
+// local time in the zone given with --assume-tz when written without. Movie
+// and track header times are in UTC and are converted to the zone given with
+// --assume-tz, or local zone.
+func (m *mp4Metadata) DateTime() (time.Time, error) {
+	if value, ok := m.keys[appleCreationDateKey]; ok {
+		for _, layout := range appleCreationDateLayouts {
+			// times without offset are wall clock of the capture zone
+			if t, err := time.ParseInLocation(layout, value, captureZone()); err == nil {
+				return t, nil
+			}
+		}
+	}
+	if !m.movieCreation.IsZero() {
+		return m.movieCreation.In(captureZone()), nil
+	}
+	if !m.trackCreation.IsZero() {
+		return m.trackCreation.In(captureZone()), nil
+	}
+	return time.Time{}, errNoMp4Time
+}
+
+// decodeMp4 walks the box structure of an ISO-BMFF file and collects movie
+// header, track header and QuickTime metadata values. Only the boxes needed
+// are read, so the cost does not depend on the size of the media data.
+func decodeMp4(r io.ReaderAt, size int64) (*mp4Metadata, error) {
+	meta := &mp4Metadata{
+		keys: make(map[string]string),
+	}
+
+	boxes, err := readMp4Boxes(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	if len(boxes) == 0 || !mp4TopLevelBoxes[boxes[0].typ] {
+		return nil, errors.New("mp4: not an iso media file")
+	}
+
+	moov := findMp4Box(boxes, "moov")
+	if moov == nil {
+		return nil, errors.New("mp4: moov box not found")
+	}
+	children, err := readMp4Boxes(r, moov.data, moov.end)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, box := range children {
+		switch box.typ {
+		case "mvhd":
+			meta.movieCreation, err = readMp4HeaderTime(r, box)
+			if err != nil {
+				return nil, err
+			}
+		case "trak":
+			if !meta.trackCreation.IsZero() {
+				continue
+			}
+			trak, err := readMp4Boxes(r, box.data, box.end)
+			if err != nil {
+				return nil, err
+			}
+			if tkhd := findMp4Box(trak, "tkhd"); tkhd != nil {
+				meta.trackCreation, err = readMp4HeaderTime(r, *tkhd)
+				if err != nil {
+					return nil, err
+				}
+			}
+		case "meta":
+			if err := readMp4Keys(r, box, meta.keys); err != nil {
+				return nil, err
+			}
+		case "udta":
+			udta, err := readMp4Boxes(r, box.data, box.end)
+			if err != nil {
+				return nil, err
+			}
+			if metaBox := findMp4Box(udta, "meta"); metaBox != nil {
+				if err := readMp4Keys(r, *metaBox, meta.keys); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return meta, nil
+}
+
+// readMp4Boxes returns all boxes found between start and end offsets. It does
+// not descend into children.
+func readMp4Boxes(r io.ReaderAt, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	header := make([]byte, 16)
+
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("mp4: reading box header at %d: %s", offset, err)
+		}
+		box := mp4Box{
+			typ:    string(header[4:8]),
+			offset: offset,
+			data:   offset + 8,
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		switch size {
+		case 0:
+			// box extends to the end of the enclosing container
+			size = end - offset
+		case 1:
+			// 64-bit size follows the type
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("mp4: reading box size at %d: %s", offset, err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			box.data += 8
+		}
+		box.end = offset + size
+		if box.end < box.data || box.end > end {
+			return nil, fmt.Errorf("mp4: invalid size of '%s' box at %d", box.typ, offset)
+		}
+
+		boxes = append(boxes, box)
+		offset = box.end
+	}
+
+	return boxes, nil
+}
+
+func findMp4Box(boxes []mp4Box, typ string) *mp4Box {
+	for i := range boxes {
+		if boxes[i].typ == typ {
+			return &boxes[i]
+		}
+	}
+	return nil
+}
+
+// readMp4HeaderTime reads creation_time from mvhd or tkhd box. Version 0
+// boxes store times as 32-bit values while version 1 uses 64-bit ones. Zero
+// means the time was not set and zero time is returned.
+func readMp4HeaderTime(r io.ReaderAt, box mp4Box) (time.Time, error) {
+	buf := make([]byte, 12)
+	if box.end-box.data < 8 {
+		return time.Time{}, fmt.Errorf("mp4: '%s' box too short", box.typ)
+	}
+	n, err := r.ReadAt(buf, box.data)
+	if err != nil && !(err == io.EOF && n >= 8) {
+		return time.Time{}, fmt.Errorf("mp4: reading '%s' box: %s", box.typ, err)
+	}
+
+	var seconds uint64
+	switch buf[0] {
+	case 0:
+		seconds = uint64(binary.BigEndian.Uint32(buf[4:8]))
+	case 1:
+		if n < 12 || box.end-box.data < 12 {
+			return time.Time{}, fmt.Errorf("mp4: '%s' box too short", box.typ)
+		}
+		seconds = binary.BigEndian.Uint64(buf[4:12])
+	default:
+		return time.Time{}, fmt.Errorf("mp4: unsupported '%s' box version %d", box.typ, buf[0])
+	}
+
+	if seconds == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(int64(seconds)-mp4EpochOffset, 0).UTC(), nil
+}
+
+// readMp4Keys reads QuickTime metadata stored as a pair of keys and ilst
+// boxes within meta box. String values are stored into keys map.
+func readMp4Keys(r io.ReaderAt, meta mp4Box, keys map[string]string) error {
+	// QuickTime meta box is a plain container while ISO meta box is a full
+	// box with version and flags before children; detect which one it is
+	start := meta.data
+	buf := make([]byte, 8)
+	if _, err := r.ReadAt(buf, start); err != nil {
+		return fmt.Errorf("mp4: reading meta box: %s", err)
+	}
+	if binary.BigEndian.Uint32(buf[0:4]) == 0 {
+		start += 4
+	}
+
+	children, err := readMp4Boxes(r, start, meta.end)
+	if err != nil {
+		return err
+	}
+	keysBox := findMp4Box(children, "keys")
+	ilstBox := findMp4Box(children, "ilst")
+	if keysBox == nil || ilstBox == nil {
+		return nil
+	}
+
+	// keys: version/flags, entry count, then size+namespace+name entries
+	keysData := make([]byte, keysBox.end-keysBox.data)
+	if _, err := r.ReadAt(keysData, keysBox.data); err != nil {
+		return fmt.Errorf("mp4: reading keys box: %s", err)
+	}
+	if len(keysData) < 8 {
+		return errors.New("mp4: keys box too short")
+	}
+	// each entry takes at least 8 bytes; compare count before converting it,
+	// since it does not fit int on 32-bit platforms
+	count := (len(keysData) - 8) / 8
+	if declared := binary.BigEndian.Uint32(keysData[4:8]); uint64(declared) < uint64(count) {
+		count = int(declared)
+	}
+	names := make([]string, 0, count)
+	for pos := 8; len(names) < count && pos+8 <= len(keysData); {
+		size := binary.BigEndian.Uint32(keysData[pos : pos+4])
+		if size < 8 || uint64(size) > uint64(len(keysData)-pos) {
+			return errors.New("mp4: invalid keys entry")
+		}
+		names = append(names, string(keysData[pos+8:pos+int(size)]))
+		pos += int(size)
+	}
+
+	// ilst: children are named by 1-based index into keys and hold data box
+	items, err := readMp4Boxes(r, ilstBox.data, ilstBox.end)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		index := int(binary.BigEndian.Uint32([]byte(item.typ)))
+		if index < 1 || index > len(names) {
+			continue
+		}
+		values, err := readMp4Boxes(r, item.data, item.end)
+		if err != nil {
+			return err
+		}
+		data := findMp4Box(values, "data")
+		if data == nil || data.end-data.data < 8 {
+			continue
+		}
+		value := make([]byte, data.end-data.data)
+		if _, err := r.ReadAt(value, data.data); err != nil {
+			return fmt.Errorf("mp4: reading data box: %s", err)
+		}
+		// type indicator 1 is UTF-8 string
+		if binary.BigEndian.Uint32(value[0:4]) != 1 {
+			continue
+		}
+		keys[names[index-1]] = strings.TrimRight(string(value[8:]), "\x00")
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+)
+
+func mkMp4Box(typ string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	box := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(box[0:4], uint32(8+len(data)))
+	copy(box[4:8], typ)
+	return append(box, data...)
+}
+
+func TestDecodeMp4(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"../test/mvhd-20190305.mp4", "2019-03-05T12:00:00Z"},
+		{"../test/quicktime-20190410.mov", "2019-04-10T09:15:00+02:00"},
+	}
+
+	for _, test := range tests {
+		file, err := os.Open(test.path)
+		if err != nil {
+			t.Fatalf("%s: %s", test.path, err)
+		}
+		meta, err := decodeMp4(file, mkInfo(test.path).Size())
+		file.Close()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.path, err)
+			continue
+		}
+		time, err := meta.DateTime()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.path, err)
+		} else if time.Format("2006-01-02T15:04:05Z07:00") != test.expected {
+			t.Errorf("%s: expected:%s got:%s", test.path, test.expected, time)
+		}
+	}
+}
+
+func TestDecodeMp4Version1LargeSize(t *testing.T) {
+	// mvhd version 1 with 64-bit times, wrapped in moov using 64-bit size
+	mvhd := make([]byte, 32)
+	mvhd[0] = 1
+	binary.BigEndian.PutUint64(mvhd[4:12], uint64(time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC).Unix()+mp4EpochOffset))
+	inner := mkMp4Box("mvhd", mvhd)
+	moov := make([]byte, 16)
+	binary.BigEndian.PutUint32(moov[0:4], 1)
+	copy(moov[4:8], "moov")
+	binary.BigEndian.PutUint64(moov[8:16], uint64(16+len(inner)))
+	data := append(mkMp4Box("ftyp", []byte("isom")), append(moov, inner...)...)
+
+	meta, err := decodeMp4(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !meta.movieCreation.Equal(time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time: %s", meta.movieCreation)
+	}
+}
+
+func TestDecodeMp4Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"jpeg", []byte{0xff, 0xd8, 0xff, 0xe1, 0, 0, 0, 0}},
+		{"no moov", mkMp4Box("ftyp", []byte("isom"))},
+		{"truncated", mkMp4Box("ftyp", []byte("isom"))[:10]},
+	}
+
+	for _, test := range tests {
+		if _, err := decodeMp4(bytes.NewReader(test.data), int64(len(test.data))); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+
+	unset := mkMp4Box("moov", mkMp4Box("mvhd", make([]byte, 100)))
+	meta, err := decodeMp4(bytes.NewReader(unset), int64(len(unset)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := meta.DateTime(); err != errNoMp4Time {
+		t.Errorf("expected errNoMp4Time, got: %v", err)
+	}
+}
+
+// mkMp4Keys returns QuickTime meta box holding keys with their values; count
+// is written as entry count of keys box.
+func mkMp4Keys(count uint32, keys ...string) []byte {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[4:8], count)
+	entries := [][]byte{header}
+	var items [][]byte
+	for i := 0; i+1 < len(keys); i += 2 {
+		entries = append(entries, mkMp4Box("mdta", []byte(keys[i])))
+		data := append([]byte{0, 0, 0, 1, 0, 0, 0, 0}, keys[i+1]...)
+		var index [4]byte
+		binary.BigEndian.PutUint32(index[:], uint32(i/2+1))
+		items = append(items, mkMp4Box(string(index[:]), mkMp4Box("data", data)))
+	}
+	return mkMp4Box("meta", mkMp4Box("keys", entries...), mkMp4Box("ilst", items...))
+}
+
+func TestDecodeMp4Keys(t *testing.T) {
+	assumedZone = time.FixedZone("", 3600)
+	defer func() { assumedZone = nil }()
+
+	tests := []struct {
+		name     string
+		count    uint32
+		date     string
+		expected string
+	}{
+		{"offset", 1, "2019-04-10T09:15:00+0200", "2019-04-10T09:15:00+02:00"},
+		{"no offset", 1, "2019-04-10T09:15:00", "2019-04-10T09:15:00+01:00"},
+		// entry count far beyond the box size must not be trusted
+		{"huge count", 0xffffffff, "2019-04-10T09:15:00Z", "2019-04-10T09:15:00Z"},
+		{"count above int32", 0x80000000, "2019-04-10T09:15:00Z", "2019-04-10T09:15:00Z"},
+	}
+
+	for _, test := range tests {
+		data := append(mkMp4Box("ftyp", []byte("qt  ")), mkMp4Box("moov", mkMp4Keys(test.count, appleCreationDateKey, test.date))...)
+		meta, err := decodeMp4(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		time, err := meta.DateTime()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		} else if time.Format("2006-01-02T15:04:05Z07:00") != test.expected {
+			t.Errorf("%s: expected:%s got:%s", test.name, test.expected, time)
+		}
+	}
+}
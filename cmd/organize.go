@@ -15,17 +15,17 @@
 package cmd
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
-	"github.com/xor-gate/goexif2/exif"
 )
 
 var destinationDirectoryFormat string
@@ -34,19 +34,80 @@ var allFiles bool
 var hiddenFiles bool
 var useExifTime bool
 var useFileTime bool
+var useBirthTime bool
 var useFilenameEncodedTime bool
+var useDirnameTime bool
+var inferSequence bool
+var useSidecarTime bool
+var useXmpTime bool
 var renameDuplicates bool
 var deleteDuplicates bool
 
-var filenameWithTimeRE = regexp.MustCompile(`^(?i:IMG|VID)_([[:digit:]]{8}_[[:digit:]]{6})\.(?i:jpg|mp4|3gp)$`)
-var timeLayoutFromFilenameWithDate = TimeFormat("yyyymmdd_HHMMSS")
-var filenameWithTimeRE2 = regexp.MustCompile(`^([[:digit:]]{4}-[[:digit:]]{2}-[[:digit:]]{2} [[:digit:]]{2}\.[[:digit:]]{2}\.[[:digit:]]{2})\.(?i:jpg|mp4|3gp)$`)
-var timeLayoutFromFilenameWithDate2 = TimeFormat("yyyy-mm-dd HH.MM.SS")
-
 var acceptedFileTypes = map[string]bool{
 	".jpg":  true,
 	".jpeg": true,
-	// ".mp4":  true,
+	".mp4":  true,
+	".m4v":  true,
+	".mov":  true,
+	".3gp":  true,
+	".heic": true,
+	".heif": true,
+	".cr2":  true,
+	".nef":  true,
+	".arw":  true,
+	".dng":  true,
+	".orf":  true,
+	".rw2":  true,
+	".tif":  true,
+	".tiff": true,
+	".png":  true,
+	".webp": true,
+	".gif":  true,
+	".mkv":  true,
+	".webm": true,
+	".avi":  true,
+	".mts":  true,
+	".m2ts": true,
+}
+
+// heifFileTypes are extensions of HEIF images which store exif as an item
+// inside ISO-BMFF container.
+var heifFileTypes = map[string]bool{
+	".heic": true,
+	".heif": true,
+}
+
+// isoMediaFileTypes are extensions of ISO-BMFF/QuickTime files whose capture
+// time is read from movie header rather than exif.
+var isoMediaFileTypes = map[string]bool{
+	".mp4": true,
+	".m4v": true,
+	".mov": true,
+	".3gp": true,
+}
+
+// embeddedMetadataDecoders decode meta data of screenshot and web image
+// formats, which store exif, XMP and creation time in their own chunks.
+var embeddedMetadataDecoders = map[string]func(io.ReaderAt, int64) (*embeddedMetadata, error){
+	".png":  decodePng,
+	".webp": decodeWebp,
+	".gif":  decodeGif,
+}
+
+// videoTimeDecoders read capture time of video containers other than
+// ISO-BMFF.
+var videoTimeDecoders = map[string]func(io.ReaderAt, int64) ([]metadataTime, error){
+	".mkv":  decodeMkvTimes,
+	".webm": decodeMkvTimes,
+	".avi":  decodeAviTimes,
+	".mts":  decodeAvchdTimes,
+	".m2ts": decodeAvchdTimes,
+}
+
+// isVideo returns true for extensions of video files.
+func isVideo(ext string) bool {
+	_, ok := videoTimeDecoders[ext]
+	return ok || isoMediaFileTypes[ext]
 }
 
 // organizeCmd represents the organize command
@@ -60,8 +121,44 @@ var organizeCmd = &cobra.Command{
 	// This application is a tool to generate the needed files
 	// to quickly create a Cobra application.`,
 	Args: cobra.ExactArgs(2),
-	PreRun: func(cmd *cobra.Command, args []string) {
-		destinationDirectoryFormat = TimeFormat(destinationDirectoryFormat)
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		if err = initDirectoryTemplate(); err != nil {
+			return err
+		}
+		if nameFormat != "" {
+			if _, err = parseTemplate(nameFormat, false); err != nil {
+				return fmt.Errorf("invalid --name-fmt: %s", err)
+			}
+		}
+		if eventGap > 0 {
+			if _, err = parseTemplate(eventFormat, true); err != nil {
+				return fmt.Errorf("invalid --event-fmt: %s", err)
+			}
+		}
+		if filenamePatterns, err = compileFilenamePatterns(userFilenamePatterns); err != nil {
+			return err
+		}
+		if err = initTimeZones(); err != nil {
+			return err
+		}
+		if err = initLocale(); err != nil {
+			return err
+		}
+		if err = initGeocoder(); err != nil {
+			return err
+		}
+		if !sidecarModes[sidecarMode] {
+			return fmt.Errorf("invalid --sidecars value '%s'; use move or drop", sidecarMode)
+		}
+		clockRules = nil
+		if clockRulesFile != "" {
+			if clockRules, err = loadClockRules(clockRulesFile); err != nil {
+				return err
+			}
+		}
+		_, err = lookupTimeSources(timeSourceNames)
+		return err
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		organize(args[0], args[1])
@@ -75,13 +172,37 @@ func init() {
 	// and all subcommands, e.g.:
 	// organizeCmd.PersistentFlags().String("foo", "", "A help for foo")
 
-	organizeCmd.Flags().StringVar(&destinationDirectoryFormat, "dir-fmt", "yyyy", "Directory format")
+	organizeCmd.Flags().StringVar(&destinationDirectoryFormat, "dir-fmt", "yyyy", "Directory format. Meta data can be included using {Make}, {Model}, {Lens}, {Rating}, {Keywords}, {kind}, {dir} etc.")
+	organizeCmd.Flags().StringVar(&nameFormat, "name-fmt", "", "File name format, e.g. '{yyyy}{mm}{dd}_{HH}{MM}{SS}_{model}.{ext}'. Placeholders take default after '|', e.g. {model|camera}. Default keeps names.")
 	organizeCmd.Flags().Int64Var(&minSize, "min-size", 0, "Minimum file size to consider for processing.")
-	organizeCmd.Flags().BoolVar(&allFiles, "all-files", false, "Process all files. Default is only images (jpg).")
+	organizeCmd.Flags().BoolVar(&allFiles, "all-files", false, "Process all files. Default is only images and videos.")
 	organizeCmd.Flags().BoolVar(&hiddenFiles, "hidden-files", false, "Process hidden files. Default is only normal files.")
+	organizeCmd.Flags().BoolVar(&detectByContent, "detect-by-content", false, "Determine file type from content rather than extension.")
 	organizeCmd.Flags().BoolVar(&useExifTime, "use-exif-time", true, "Use time from exif meta data.")
 	organizeCmd.Flags().BoolVar(&useFileTime, "use-file-time", false, "Use file modification time when no meta data.")
+	organizeCmd.Flags().BoolVar(&useBirthTime, "use-birth-time", false, "Use file creation time when no meta data, where the file system records it.")
 	organizeCmd.Flags().BoolVar(&useFilenameEncodedTime, "use-filename-encoded-time", true, "Attempt to parse time from filename.")
+	organizeCmd.Flags().BoolVar(&useSidecarTime, "use-sidecar-time", true, "Use time from sidecar files, e.g. Google Takeout JSON.")
+	organizeCmd.Flags().StringVar(&sidecarMode, "sidecars", "move", "What to do with sidecar files of moved files: 'move' them along, or 'drop' them.")
+	organizeCmd.Flags().BoolVar(&useXmpTime, "use-xmp-time", true, "Use time from XMP sidecars and XMP embedded in jpeg, png, webp and gif files.")
+	organizeCmd.Flags().IntVar(&minRating, "min-rating", -1, "Process only files with XMP rating of at least this; unrated files have rating 0 and rejected -1.")
+	organizeCmd.Flags().StringSliceVar(&requiredKeywords, "keyword", nil, "Process only files with at least one of these IPTC or XMP keywords.")
+	organizeCmd.Flags().BoolVar(&useDirnameTime, "use-dirname-time", true, "Attempt to parse date from names of containing directories.")
+	organizeCmd.Flags().StringArrayVar(&userFilenamePatterns, "filename-pattern", nil, "Additional pattern for parsing time from filename, in layout=regex form, e.g. 'yyyymmdd=^DSC(?P<time>[0-9]{8})'. Can be repeated.")
+	organizeCmd.Flags().StringSliceVar(&timeSourceNames, "time-sources", defaultTimeSources, "Order in which sources of date/time are consulted. Sources can be disabled with --use-* flags.")
+	organizeCmd.Flags().BoolVar(&inferSequence, "infer-from-sequence", false, "Infer time of undated files from files with nearby sequence numbers, e.g. DSC_0122.JPG and DSC_0124.JPG.")
+	organizeCmd.Flags().IntVar(&maxSequenceGap, "max-sequence-gap", 10, "Largest difference in sequence numbers used by --infer-from-sequence.")
+	organizeCmd.Flags().StringVar(&assumeTimeZone, "assume-tz", "", "Time zone of times without zone information, e.g. 'Europe/Belgrade' or '+02:00'. Default is local zone.")
+	organizeCmd.Flags().DurationVar(&eventGap, "event-gap", 0, "Group files into events, starting new event after a gap in time longer than this, e.g. 6h. Events are placed into directories given by --event-fmt.")
+	organizeCmd.Flags().Float64Var(&eventDistance, "event-distance", 0, "With --event-gap, also start new event when photo was taken further than this many kilometers from the previous one.")
+	organizeCmd.Flags().StringVar(&eventFormat, "event-fmt", "yyyy/yyyy-mm-dd {event}", "Directory format of events, applied to the time the event started; {event} is the number of the event.")
+	organizeCmd.Flags().StringVar(&eventSummaryFile, "event-summary", "", "Write list of events into this JSON file, or CSV file if it ends with .csv. Events can then be named using rename-event command.")
+	organizeCmd.Flags().StringVar(&geoNamesFile, "geonames", "", "GeoNames cities file, e.g. cities1000.zip from download.geonames.org/export/dump, used for {country} and {city} of photos with GPS position.")
+	organizeCmd.Flags().StringVar(&localeName, "locale", "en", "Language of month and weekday names in --dir-fmt and --name-fmt, e.g. de, fr or sr.")
+	organizeCmd.Flags().StringVar(&directoryTimeZone, "dir-tz", "capture", "Time zone used for directory names; 'capture' uses local time where the photo was taken.")
+	organizeCmd.Flags().StringVar(&clockRulesFile, "clock-rules", "", "JSON file with rules correcting time of cameras with wrong clock. See calibrate command.")
+	organizeCmd.Flags().DurationVar(&conflictThreshold, "conflict-threshold", 24*time.Hour, "Report files whose time sources disagree by more than this.")
+	organizeCmd.Flags().BoolVar(&skipConflicts, "skip-conflicts", false, "Do not move files whose time sources disagree.")
 	organizeCmd.Flags().BoolVar(&renameDuplicates, "rename-duplicates", false, "Rename duplicates by appending -1, -2 etc.")
 	organizeCmd.Flags().BoolVar(&deleteDuplicates, "delete-duplicates", false, "Delete source files if already exist in destination.")
 }
@@ -93,14 +214,45 @@ type fileinfo struct {
 	info       os.FileInfo
 	message    string
 	time       time.Time
+	precision  timePrecision
 	contents   []byte
 	file       *os.File
 	matchGroup int
+	timeSource string
+	confidence confidence
+	// metadata identifies the camera, keyed by exif field names
+	metadata map[string]string
+	// clockCorrection is the offset applied to time by a clock rule
+	clockCorrection time.Duration
+	// candidates are plausible times found by all time sources
+	candidates []timeCandidate
+	// conflict is set when time sources disagree
+	conflict bool
+	// sidecars hold meta data of the file and move with it
+	sidecars []sidecarFile
+	// location is where the photo was taken, if known
+	location *geoLocation
+	// mediaExt is the extension selecting how the file is parsed
+	mediaExt string
+	// root is the directory the file was found in by getFiles
+	root string
+	// hash is the start of SHA-256 of file contents, once computed
+	hash string
+	// event is the group of files taken together, with --event-gap
+	event *photoEvent
+	// keywords from IPTC and XMP, merged; also joined in metadata
+	keywords []string
+	// group holds files sharing base name, moved together
+	group *companionGroup
+	// livePhoto is the video of Live Photo still, or the still of its video
+	livePhoto *fileinfo
+	// duplicateOf is the file with the same contents, kept by dedupe
+	duplicateOf *fileinfo
 }
 
-type filterFunc func(info os.FileInfo) (accepted bool, reason string)
+type filterFunc func(path string, info os.FileInfo) (accepted bool, reason string)
 
-func acceptExifFile(info os.FileInfo) (accepted bool, reason string) {
+func acceptExifFile(path string, info os.FileInfo) (accepted bool, reason string) {
 	mode := info.Mode()
 	if !mode.IsRegular() {
 		return false, "not regular file"
@@ -114,13 +266,22 @@ func acceptExifFile(info os.FileInfo) (accepted bool, reason string) {
 	if !hiddenFiles && filename[0] == '.' {
 		return false, "hidden file"
 	}
-	ext := strings.ToLower(filepath.Ext(filename))
-	if !allFiles && !acceptedFileTypes[ext] {
-		return false, "not image file"
+	if companionFileTypes[strings.ToLower(filepath.Ext(filename))] {
+		// moved with media of the same name, if any
+		return true, ""
 	}
 	if info.Size() < minSize {
 		return false, "small file"
 	}
+	if !allFiles {
+		ext := strings.ToLower(filepath.Ext(filename))
+		if detectByContent {
+			ext = detectMediaType(path)
+		}
+		if !acceptedFileTypes[ext] {
+			return false, "not image file"
+		}
+	}
 	return true, ""
 }
 
@@ -144,7 +305,7 @@ func getFiles(dir string, accept filterFunc) (files []*fileinfo, er error) {
 		}
 
 		if accept != nil {
-			if ok, reason := accept(info); !ok {
+			if ok, reason := accept(path, info); !ok {
 				Info("\r%s: skipping: %s\n", path, reason)
 				return nil
 			}
@@ -161,6 +322,7 @@ func getFiles(dir string, accept filterFunc) (files []*fileinfo, er error) {
 		retVal = append(retVal, &fileinfo{
 			path: path,
 			info: info,
+			root: dir,
 		})
 
 		if len(retVal)%1000 == 0 {
@@ -181,70 +343,185 @@ func getFiles(dir string, accept filterFunc) (files []*fileinfo, er error) {
 func evaluate(files []*fileinfo, dest string) {
 	fileCount := len(files)
 
+	sources, err := activeTimeSources()
+	if err != nil {
+		Print("%s\n", err)
+		return
+	}
+	for _, source := range sources {
+		if preparer, ok := source.(timeSourcePreparer); ok {
+			preparer.Prepare(files)
+		}
+	}
+	groupCompanions(files)
+	findSidecars(files)
+
+	// rating and keywords are read by xmp time source, if it is used
+	readXmp := xmpMetadataNeeded()
+	for _, source := range sources {
+		if source.Name() == "xmp" {
+			readXmp = false
+		}
+	}
+
+	var undated []*fileinfo
 	for i, file := range files {
 		Print("\rEvaluated %d out of %d files.", i, fileCount)
+		if isCompanionFile(file.path) {
+			// moved with their media, or skipped without it
+			continue
+		}
 
-		foundTime := false
-
-		if !foundTime && useExifTime {
-			is, err := os.Open(file.path)
-			if err != nil {
-				Info("\r%s: error opening file (%s)\n", file.path, err)
-			} else {
-				exinfo, err := exif.Decode(is)
-				if err != nil {
-					Info("\r%s: error reading meta data (%s)\n", file.path, err)
-				} else {
-					time, err := exinfo.DateTime()
-					if err == nil {
-						foundTime = true
-						file.time = time
-					}
-				}
-				if err := is.Close(); err != nil {
-					Print("\r%s: unexpected error closing read stream (%s)\n", file.path, err)
-				}
+		readIptcMetadata(file)
+		found := determineTime(file, sources)
+		if readXmp {
+			if err := readXmpMetadata(file); err != nil {
+				Info("\r%s: error reading xmp (%s)\n", file.path, err)
 			}
 		}
-
-		if !foundTime && useFilenameEncodedTime {
-			match := filenameWithTimeRE.FindStringSubmatch(file.info.Name())
-			if match != nil {
-				time, err := time.Parse(timeLayoutFromFilenameWithDate, match[1])
-				if err == nil {
-					foundTime = true
-					file.time = time
-				}
+		if reason := filterReason(file); reason != "" {
+			file.message = fmt.Sprintf("%s: skipped, %s", file.path, reason)
+			Info("\r%s\n", file.message)
+			continue
+		}
+		if !found {
+			if inferSequence {
+				// may be inferred from neighbours once all files are evaluated
+				undated = append(undated, file)
+				continue
 			}
+			file.message = fmt.Sprintf("%s: could not determine date/time", file.path)
+			Print("\r%s\n", file.message)
+			continue
 		}
-		if !foundTime && useFilenameEncodedTime {
-			match := filenameWithTimeRE2.FindStringSubmatch(file.info.Name())
-			if match != nil {
-				time, err := time.Parse(timeLayoutFromFilenameWithDate2, match[1])
-				if err == nil {
-					foundTime = true
-					file.time = time
-				}
+		Info("\r%s: %s from %s (%s confidence)\n", file.path, file.time, file.timeSource, file.confidence)
+		if len(file.metadata) > 0 {
+			Info("\r%s: %s\n", file.path, describeMetadata(file.metadata))
+		}
+		if file.conflict && skipConflicts {
+			file.message = fmt.Sprintf("%s: sources disagree on date/time", file.path)
+			Print("\r%s\n", file.message)
+			continue
+		}
+
+		setDestination(file, dest)
+	}
+
+	Print("\rEvaluated %d out of %d files.\n", fileCount, fileCount)
+
+	if len(undated) > 0 {
+		inferSequenceTimes(files)
+		for _, file := range undated {
+			if file.time.IsZero() {
+				file.message = fmt.Sprintf("%s: could not determine date/time", file.path)
+				Print("\r%s\n", file.message)
+				continue
 			}
+			Print("\r%s: %s from %s (%s confidence)\n", file.path, file.time, file.timeSource, file.confidence)
+			setDestination(file, dest)
 		}
+	}
 
-		if !foundTime && useFileTime {
-			file.time = file.info.ModTime()
-			foundTime = true
+	pairLivePhotos(files)
+	chooseCompanionPrimaries(files)
+	events := clusterEvents(files, dest)
+	if eventSummaryFile != "" && len(events) > 0 && !dryRun {
+		if err := writeEventSummary(eventSummaryFile, events); err != nil {
+			Print("Failed to write event summary: %s\n", err)
 		}
+	}
+	applyNameFormat(files)
+	followCompanionPrimaries(files)
+	reportConflicts(files)
+}
 
-		if !foundTime {
-			file.message = fmt.Sprintf("%s: could not determine date/time", file.path)
+// setDestination computes new path of the file from its time.
+func setDestination(file *fileinfo, dest string) {
+	newDir := directoryTemplate.format(directoryTime(file.time), file, 0)
+	if file.precision != precisionFull {
+		// directory time zone does not apply to dates without time
+		newDir = coarseDirectory(directoryTemplate, file)
+		if newDir == "" {
+			file.message = fmt.Sprintf("%s: date/time known only to %s precision", file.path, file.precision)
 			Print("\r%s\n", file.message)
-			continue
+			return
 		}
+	}
+	file.newDir = filepath.Join(dest, newDir)
+	file.newPath = filepath.Join(file.newDir, file.info.Name())
+}
 
-		newDir := file.time.Format(destinationDirectoryFormat)
-		file.newDir = filepath.Join(dest, newDir)
-		file.newPath = filepath.Join(file.newDir, file.info.Name())
+// readMetadataTimes returns capture times embedded in the file, most
+// preferred first. No times with no error means the meta data was readable
+// but contained no time. Fields identifying the camera are stored into
+// file.metadata.
+func readMetadataTimes(is *os.File, file *fileinfo) ([]metadataTime, error) {
+	ext := file.mediaType()
+	if isoMediaFileTypes[ext] {
+		meta, err := decodeMp4(is, file.info.Size())
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range meta.Metadata() {
+			file.setMetadata(key, value)
+		}
+		if time, err := meta.DateTime(); err == nil {
+			return []metadataTime{{time: time}}, nil
+		}
+		return nil, nil
 	}
 
-	Print("\rEvaluated %d out of %d files.\n", fileCount, fileCount)
+	if decode, ok := videoTimeDecoders[ext]; ok {
+		return decode(is, file.info.Size())
+	}
+
+	if decode, ok := embeddedMetadataDecoders[ext]; ok {
+		embedded, err := decode(is, file.info.Size())
+		if err != nil {
+			return nil, err
+		}
+		return embeddedMetadataTimes(embedded, file)
+	}
+
+	exinfo, err := decodeExif(is, file)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range exifMetadata(exinfo) {
+		file.setMetadata(key, value)
+	}
+	if location, ok := exifLocation(exinfo); ok && file.location == nil {
+		file.location = location
+	}
+	return exifCaptureTimes(exinfo), nil
+}
+
+// embeddedMetadataTimes returns exif times and PNG creation time found in
+// the file chunks.
+func embeddedMetadataTimes(embedded *embeddedMetadata, file *fileinfo) ([]metadataTime, error) {
+	var times []metadataTime
+	if embedded.exif != nil {
+		exinfo, err := decodeTiffExif(bytes.NewReader(embedded.exif))
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range exifMetadata(exinfo) {
+			file.setMetadata(key, value)
+		}
+		if location, ok := exifLocation(exinfo); ok && file.location == nil {
+			file.location = location
+		}
+		times = exifCaptureTimes(exinfo)
+	}
+	if embedded.creationTime != "" {
+		// free form text; one not understood must not hide exif times
+		if t, err := parsePngCreationTime(embedded.creationTime); err != nil {
+			Info("\r%s: ignoring %s '%s' (%s)\n", file.path, pngCreationTimeKeyword, embedded.creationTime, err)
+		} else {
+			times = append(times, metadataTime{field: pngCreationTimeKeyword, time: t})
+		}
+	}
+	return times, nil
 }
 
 func processDuplicates(files []*fileinfo) {
@@ -287,81 +564,157 @@ func processDuplicates(files []*fileinfo) {
 func execute(files []*fileinfo) {
 	fileCount := len(files)
 
-FILES:
 	for i, file := range files {
 		Print("\rMoved %d out of %d files.", i, fileCount)
 
-		if file.newPath == "" {
+		if file.newPath == "" || !file.isPrimary() {
+			continue
+		}
+
+		group := companionFiles(file)
+		if !checkCompanions(group) || !resolveDestinations(group) {
 			continue
 		}
+		moveFiles(group)
+	}
+
+	Print("\rMoved %d out of %d files.\n", fileCount, fileCount)
+}
 
-		var namePostfix int // 0 if
-		var ext string
-		var name string
-		// guard against overwriting
-	DUPES:
-		for {
+// checkCompanions returns true if all files of the group are to be moved,
+// e.g. none was found to be a duplicate.
+func checkCompanions(files []*fileinfo) bool {
+	for _, file := range files[1:] {
+		if file.newPath == "" {
+			files[0].message = fmt.Sprintf("%s: not moved, companion %s is not moved", files[0].path, file.path)
+			Print("\r%s\n", files[0].message)
+			return false
+		}
+	}
+	return true
+}
+
+// resolveDestinations guards against overwriting existing files. When any
+// of the files or their moved sidecars exists at its destination, all files
+// get the same -1, -2 etc. postfix with --rename-duplicates, are deleted with
+// --delete-duplicates if all of the files exist, or are not moved. Returns
+// false if files are not to be moved.
+func resolveDestinations(files []*fileinfo) bool {
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = filepath.Base(file.newPath)
+	}
+
+	var namePostfix int
+	for {
+		existing := 0
+		var first *fileinfo
+		var firstPath string
+		for _, file := range files {
 			dest, err := os.Lstat(file.newPath)
 			if err != nil {
-				if os.IsNotExist(err) {
-					// all is good, proceed
-					break DUPES
-				} else {
+				if !os.IsNotExist(err) {
 					file.message = fmt.Sprintf("%s: problem checking destination: %s", file.newPath, err)
 					Print("\r%s\n", file.message)
-					continue FILES
+					return false
+				}
+				// media is free, but its sidecars must not overwrite
+				// sidecars of another file either
+				path, err := existingSidecarDestination(file)
+				if err != nil {
+					file.message = err.Error()
+					Print("\r%s\n", file.message)
+					return false
+				}
+				if path != "" && first == nil {
+					first, firstPath = file, path
 				}
+				continue
 			} else if os.SameFile(file.info, dest) {
 				file.message = fmt.Sprintf("%s: same file", file.newPath)
 				Print("\r%s\n", file.message)
-				continue FILES
-			} else if renameDuplicates {
-				if namePostfix > 999 {
-					file.message = fmt.Sprintf("%s: too many identical files", file.newPath)
-					Print("\r%s\n", file.message)
-					continue FILES
-				} else if namePostfix > 0 {
-					namePostfix++
-				} else {
-					namePostfix = 1
-					name = file.info.Name()
-					ext = filepath.Ext(name)
-					name = name[:len(name)-len(ext)]
-				}
+				return false
+			}
+			existing++
+			if first == nil {
+				first, firstPath = file, file.newPath
+			}
+		}
+		if first == nil {
+			return true
+		}
+
+		if renameDuplicates {
+			if namePostfix > 999 {
+				first.message = fmt.Sprintf("%s: too many identical files", firstPath)
+				Print("\r%s\n", first.message)
+				return false
+			}
+			namePostfix++
+			for i, file := range files {
+				ext := filepath.Ext(names[i])
+				name := names[i][:len(names[i])-len(ext)]
 				file.newPath = filepath.Join(file.newDir, fmt.Sprintf("%s-%d%s", name, namePostfix, ext))
-			} else if deleteDuplicates {
+			}
+		} else if deleteDuplicates && existing == len(files) {
+			for _, file := range files {
 				file.message = fmt.Sprintf("rm %s", file.path)
 				Print("\r%s\n", file.message)
 				if !dryRun {
 					if err := OS.Remove(file.path); err != nil {
 						file.message = fmt.Sprintf("%s: failed to delete file (%s)", file.newPath, err)
 						Print("\r%s\n", file.message)
+						continue
 					}
 				}
-				continue FILES
-			} else {
-				file.message = fmt.Sprintf("%s: already exists", file.newPath)
-				Print("\r%s\n", file.message)
-				continue FILES
+				processDuplicateSidecars(file)
 			}
+			return false
+		} else {
+			first.message = fmt.Sprintf("%s: already exists", firstPath)
+			Print("\r%s\n", first.message)
+			return false
 		}
+	}
+}
 
-		if dryRun {
-			// TODO: warn that dry run does not account for duplicates
+// moveFiles moves the file and its companions, all of which share the
+// destination directory. If any of them fails to move, those already moved
+// are moved back so the group stays together.
+func moveFiles(files []*fileinfo) {
+	if dryRun {
+		// TODO: warn that dry run does not account for duplicates
+		for _, file := range files {
 			file.message = fmt.Sprintf("mv %s %s", file.path, file.newPath)
 			Print("\r%s\n", file.message)
-		} else {
-			if err := OS.MkdirAll(file.newDir, 0777); err != nil {
-				file.message = fmt.Sprintf("%s: failed to create directory: %s", file.newDir, err)
-				Print("\r%s\n", file.message)
-			} else if err := OS.Rename(file.path, file.newPath); err != nil {
-				file.message = fmt.Sprintf("%s: failed to copy: %s", file.newPath, err)
-				Print("\r%s\n", file.message)
-			}
+			processSidecars(file)
 		}
+		return
 	}
 
-	Print("\rMoved %d out of %d files.\n", fileCount, fileCount)
+	if err := OS.MkdirAll(files[0].newDir, 0777); err != nil {
+		files[0].message = fmt.Sprintf("%s: failed to create directory: %s", files[0].newDir, err)
+		Print("\r%s\n", files[0].message)
+		return
+	}
+	for i, file := range files {
+		if err := OS.Rename(file.path, file.newPath); err != nil {
+			file.message = fmt.Sprintf("%s: failed to copy: %s", file.newPath, err)
+			Print("\r%s\n", file.message)
+			for _, moved := range files[:i] {
+				if err := OS.Rename(moved.newPath, moved.path); err != nil {
+					moved.message = fmt.Sprintf("%s: failed to move back: %s", moved.newPath, err)
+				} else {
+					moved.message = fmt.Sprintf("%s: not moved, companion %s failed to move", moved.path, file.path)
+				}
+				Print("\r%s\n", moved.message)
+			}
+			return
+		}
+	}
+	for _, file := range files {
+		processSidecars(file)
+	}
 }
 
 func organize(src, dest string) {
@@ -371,6 +724,7 @@ func organize(src, dest string) {
 		return
 	}
 	evaluate(files, dest)
+	excludeSidecars(files)
 	processDuplicates(files)
 	execute(files)
 }
@@ -17,6 +17,7 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -41,6 +42,15 @@ func TestAcceptFile(t *testing.T) {
 		{"../test/jpg.wrong-extension", false, "not image file", 0, false, false},
 		{"../test/jpg.wrong-extension", true, "", 0, true, false},
 		{"../test/no-exif.jpg", true, "", 0, false, false},
+		{"../test/mvhd-20190305.mp4", true, "", 0, false, false},
+		{"../test/quicktime-20190410.mov", true, "", 0, false, false},
+		{"../test/heic-20190615.heic", true, "", 0, false, false},
+		{"../test/canon-20160710.cr2", true, "", 0, false, false},
+		{"../test/nikon-20150520.nef", true, "", 0, false, false},
+		{"../test/sony-20140412.arw", true, "", 0, false, false},
+		{"../test/adobe-20130314.dng", true, "", 0, false, false},
+		{"../test/olympus-20120216.orf", true, "", 0, false, false},
+		{"../test/panasonic-20110118.rw2", true, "", 0, false, false},
 		{"../test/not-readable.jpg", false, "not readable file", 0, false, false},
 		{"../test/symlink.jpg", false, "not regular file", 0, false, false},
 	}
@@ -55,7 +65,7 @@ func TestAcceptFile(t *testing.T) {
 			t.Errorf("%d, file not found: %s", i, err)
 			continue
 		}
-		accepted, reason := acceptExifFile(info)
+		accepted, reason := acceptExifFile(test.path, info)
 		if accepted != test.accepted {
 			t.Errorf("%d, accepted: expected:%v got:%v", i, test.accepted, accepted)
 		}
@@ -96,6 +106,17 @@ func TestGetFiles(t *testing.T) {
 		"../test/IMG_20180304_123456.jpg":   {"../test/IMG_20180304_123456.jpg", "", "", mkInfo("../test/IMG_20180304_123456.jpg"), ""},
 		"../test/2018-03-04 12.34.56.mp4":   {"../test/2018-03-04 12.34.56.mp4", "", "", mkInfo("../test/2018-03-04 12.34.56.mp4"), ""},
 		"../test/VID_20181231_203040.mp4":   {"../test/VID_20181231_203040.mp4", "", "", mkInfo("../test/VID_20181231_203040.mp4"), ""},
+		"../test/mvhd-20190305.mp4":         {"../test/mvhd-20190305.mp4", "", "", mkInfo("../test/mvhd-20190305.mp4"), ""},
+		"../test/quicktime-20190410.mov":    {"../test/quicktime-20190410.mov", "", "", mkInfo("../test/quicktime-20190410.mov"), ""},
+		"../test/heic-20190615.heic":        {"../test/heic-20190615.heic", "", "", mkInfo("../test/heic-20190615.heic"), ""},
+		"../test/tz-gps-20200101.jpg":       {"../test/tz-gps-20200101.jpg", "", "", mkInfo("../test/tz-gps-20200101.jpg"), ""},
+		"../test/tz-offset-20200101.jpg":    {"../test/tz-offset-20200101.jpg", "", "", mkInfo("../test/tz-offset-20200101.jpg"), ""},
+		"../test/canon-20160710.cr2":        {"../test/canon-20160710.cr2", "", "", mkInfo("../test/canon-20160710.cr2"), ""},
+		"../test/nikon-20150520.nef":        {"../test/nikon-20150520.nef", "", "", mkInfo("../test/nikon-20150520.nef"), ""},
+		"../test/sony-20140412.arw":         {"../test/sony-20140412.arw", "", "", mkInfo("../test/sony-20140412.arw"), ""},
+		"../test/adobe-20130314.dng":        {"../test/adobe-20130314.dng", "", "", mkInfo("../test/adobe-20130314.dng"), ""},
+		"../test/olympus-20120216.orf":      {"../test/olympus-20120216.orf", "", "", mkInfo("../test/olympus-20120216.orf"), ""},
+		"../test/panasonic-20110118.rw2":    {"../test/panasonic-20110118.rw2", "", "", mkInfo("../test/panasonic-20110118.rw2"), ""},
 	}
 
 	allFiles = true
@@ -166,6 +187,17 @@ func TestEvaluate(t *testing.T) {
 		"../test/IMG_20180304_123456.jpg": {"../test/IMG_20180304_123456.jpg", "dest/2018/03", "dest/2018/03/IMG_20180304_123456.jpg", mkInfo("../test/IMG_20180304_123456.jpg"), ""},
 		"../test/2018-03-04 12.34.56.mp4": {"../test/2018-03-04 12.34.56.mp4", "dest/2018/03", "dest/2018/03/2018-03-04 12.34.56.mp4", mkInfo("../test/2018-03-04 12.34.56.mp4"), ""},
 		"../test/VID_20181231_203040.mp4": {"../test/VID_20181231_203040.mp4", "dest/2018/12", "dest/2018/12/VID_20181231_203040.mp4", mkInfo("../test/VID_20181231_203040.mp4"), ""},
+		"../test/mvhd-20190305.mp4":       {"../test/mvhd-20190305.mp4", "dest/2019/03", "dest/2019/03/mvhd-20190305.mp4", mkInfo("../test/mvhd-20190305.mp4"), ""},
+		"../test/quicktime-20190410.mov":  {"../test/quicktime-20190410.mov", "dest/2019/04", "dest/2019/04/quicktime-20190410.mov", mkInfo("../test/quicktime-20190410.mov"), ""},
+		"../test/heic-20190615.heic":      {"../test/heic-20190615.heic", "dest/2019/06", "dest/2019/06/heic-20190615.heic", mkInfo("../test/heic-20190615.heic"), ""},
+		"../test/tz-gps-20200101.jpg":     {"../test/tz-gps-20200101.jpg", "dest/2020/01", "dest/2020/01/tz-gps-20200101.jpg", mkInfo("../test/tz-gps-20200101.jpg"), ""},
+		"../test/tz-offset-20200101.jpg":  {"../test/tz-offset-20200101.jpg", "dest/2020/01", "dest/2020/01/tz-offset-20200101.jpg", mkInfo("../test/tz-offset-20200101.jpg"), ""},
+		"../test/canon-20160710.cr2":      {"../test/canon-20160710.cr2", "dest/2016/07", "dest/2016/07/canon-20160710.cr2", mkInfo("../test/canon-20160710.cr2"), ""},
+		"../test/nikon-20150520.nef":      {"../test/nikon-20150520.nef", "dest/2015/05", "dest/2015/05/nikon-20150520.nef", mkInfo("../test/nikon-20150520.nef"), ""},
+		"../test/sony-20140412.arw":       {"../test/sony-20140412.arw", "dest/2014/04", "dest/2014/04/sony-20140412.arw", mkInfo("../test/sony-20140412.arw"), ""},
+		"../test/adobe-20130314.dng":      {"../test/adobe-20130314.dng", "dest/2013/03", "dest/2013/03/adobe-20130314.dng", mkInfo("../test/adobe-20130314.dng"), ""},
+		"../test/olympus-20120216.orf":    {"../test/olympus-20120216.orf", "dest/2012/02", "dest/2012/02/olympus-20120216.orf", mkInfo("../test/olympus-20120216.orf"), ""},
+		"../test/panasonic-20110118.rw2":  {"../test/panasonic-20110118.rw2", "dest/2011/01", "dest/2011/01/panasonic-20110118.rw2", mkInfo("../test/panasonic-20110118.rw2"), ""},
 	}
 	files := make([]*fileinfo, 0, len(expected))
 	for _, test := range expected {
@@ -176,7 +208,7 @@ func TestEvaluate(t *testing.T) {
 	}
 
 	useFileTime = false
-	destinationDirectoryFormat = TimeFormat("yyyy/mm")
+	setDirectoryFormat(t, "yyyy/mm")
 
 	evaluate(files, "dest")
 
@@ -484,6 +516,65 @@ func TestExecuteSingleDuplicateRename(t *testing.T) {
 	}
 }
 
+func TestExecuteSidecarExists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "photo-cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// sidecar of another photo, which is not there
+	if err := ioutil.WriteFile(filepath.Join(dir, "IMG_1234.jpg.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		renameDuplicates = false
+		sidecarMode = "move"
+	}()
+	tests := []struct {
+		rename      bool
+		mode        string
+		renames     int
+		newPath     string
+		sidecarPath string
+		message     string
+	}{
+		{false, "move", 0, "IMG_1234.jpg", "", filepath.Join(dir, "IMG_1234.jpg.json") + ": already exists"},
+		{true, "move", 2, "IMG_1234-1.jpg", "IMG_1234-1.jpg.json", ""},
+		{false, "drop", 1, "IMG_1234.jpg", "", ""},
+	}
+	for _, test := range tests {
+		files := []*fileinfo{
+			&fileinfo{
+				path:     "../test/exif-20180101.jpg",
+				newDir:   dir,
+				newPath:  filepath.Join(dir, "IMG_1234.jpg"),
+				info:     mkInfo("../test/exif-20180101.jpg"),
+				sidecars: []sidecarFile{{path: "../test/exif-20180101.jpg.json", suffix: ".json"}},
+			},
+		}
+		dryRun = false
+		renameDuplicates = test.rename
+		sidecarMode = test.mode
+
+		OS := initMockOs()
+		execute(files)
+
+		if OS.rename.called != test.renames {
+			t.Errorf("%v %s: unexpected renames (%d)", test.rename, test.mode, OS.rename.called)
+		}
+		if test.sidecarPath != "" && OS.rename.newpath != filepath.Join(dir, test.sidecarPath) {
+			t.Errorf("%v %s: unexpected sidecar path (%s)", test.rename, test.mode, OS.rename.newpath)
+		}
+		if files[0].newPath != filepath.Join(dir, test.newPath) {
+			t.Errorf("%v %s: unexpected newPath (%s)", test.rename, test.mode, files[0].newPath)
+		}
+		if files[0].message != test.message {
+			t.Errorf("%v %s: unexpected message (%s)", test.rename, test.mode, files[0].message)
+		}
+	}
+}
+
 func TestExecuteGroup(t *testing.T) {
 	expected := []struct {
 		path     string
@@ -541,7 +632,6 @@ func TestExecuteGroup(t *testing.T) {
 func TestMain(m *testing.M) {
 	// call flag.Parse() here if TestMain uses flags
 
-	destinationDirectoryFormat = TimeFormat(destinationDirectoryFormat)
 	verbose = false
 	quiet = true
 
@@ -558,6 +648,10 @@ func TestMain(m *testing.M) {
 		fmt.Printf("Unable to change test file permission. (%s)\n", err)
 		os.Exit(1)
 	}
+	if err := initDirectoryTemplate(); err != nil {
+		fmt.Printf("Problem parsing default directory format. (%s)\n", err)
+		os.Exit(1)
+	}
 
 	retVal := m.Run()
 
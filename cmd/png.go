@@ -0,0 +1,166 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Keywords of PNG text chunks we read.
+const (
+	pngCreationTimeKeyword = "Creation Time"
+	pngXmpKeyword          = "XML:com.adobe.xmp"
+)
+
+// pngCreationTimeLayouts are formats of "Creation Time" text. The PNG
+// specification recommends RFC 1123, but most writers use ISO 8601 or exif
+// format. Times without zone are in capture zone.
+var pngCreationTimeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	exifTimeLayout,
+}
+
+func parsePngCreationTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range pngCreationTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, captureZone()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("png: unrecognized creation time '%s'", value)
+}
+
+// decodePng reads eXIf chunk, XMP stored in iTXt chunk and "Creation Time"
+// stored in any of text chunks. Image data is skipped.
+func decodePng(r io.ReaderAt, size int64) (*embeddedMetadata, error) {
+	signature := make([]byte, len(pngSignature))
+	if _, err := r.ReadAt(signature, 0); err != nil {
+		return nil, fmt.Errorf("png: reading header: %s", err)
+	}
+	if !bytes.Equal(signature, pngSignature) {
+		return nil, errors.New("png: not a png file")
+	}
+
+	metadata := &embeddedMetadata{}
+	header := make([]byte, 8)
+	for offset := int64(len(pngSignature)); offset+12 <= size; {
+		if _, err := r.ReadAt(header, offset); err != nil {
+			return nil, fmt.Errorf("png: reading chunk at %d: %s", offset, err)
+		}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		typ := string(header[4:8])
+		if offset+12+length > size {
+			return nil, fmt.Errorf("png: chunk %s exceeds file size", typ)
+		}
+
+		switch typ {
+		case "eXIf", "tEXt", "zTXt", "iTXt":
+			data := make([]byte, length)
+			if _, err := r.ReadAt(data, offset+8); err != nil {
+				return nil, fmt.Errorf("png: reading %s chunk: %s", typ, err)
+			}
+			if typ == "eXIf" {
+				metadata.exif = data
+			} else if keyword, text, err := parsePngText(typ, data); err == nil {
+				switch keyword {
+				case pngCreationTimeKeyword:
+					metadata.creationTime = text
+				case pngXmpKeyword:
+					metadata.xmp = []byte(text)
+				}
+			}
+		case "IEND":
+			return metadata, nil
+		}
+		offset += 12 + length // length, type, data and crc
+	}
+	return metadata, nil
+}
+
+// parsePngText returns keyword and text of tEXt, zTXt or iTXt chunk. tEXt and
+// zTXt are Latin-1 encoded, iTXt UTF-8.
+func parsePngText(typ string, data []byte) (string, string, error) {
+	separator := bytes.IndexByte(data, 0)
+	if separator < 0 {
+		return "", "", errors.New("png: text chunk without keyword")
+	}
+	keyword := string(data[:separator])
+	data = data[separator+1:]
+
+	switch typ {
+	case "tEXt":
+		return keyword, decodeIptcString(data, false), nil
+	case "zTXt":
+		if len(data) < 1 {
+			return "", "", errors.New("png: zTXt chunk too short")
+		}
+		text, err := inflate(data[1:])
+		return keyword, decodeIptcString(text, false), err
+	}
+
+	// iTXt: compression flag and method, language tag and translated keyword
+	if len(data) < 2 {
+		return "", "", errors.New("png: iTXt chunk too short")
+	}
+	compressed := data[0] == 1
+	data = data[2:]
+	for i := 0; i < 2; i++ {
+		separator := bytes.IndexByte(data, 0)
+		if separator < 0 {
+			return "", "", errors.New("png: invalid iTXt chunk")
+		}
+		data = data[separator+1:]
+	}
+	if compressed {
+		text, err := inflate(data)
+		return keyword, string(text), err
+	}
+	return keyword, string(data), nil
+}
+
+// maxInflatedSize limits decompressed text of zTXt and iTXt chunks, so that
+// a small file can not expand into gigabytes.
+const maxInflatedSize = 1 << 20
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	text, err := ioutil.ReadAll(io.LimitReader(r, maxInflatedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(text) > maxInflatedSize {
+		return nil, fmt.Errorf("png: compressed text exceeds %d bytes", maxInflatedSize)
+	}
+	return text, nil
+}
@@ -0,0 +1,219 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readTestExif returns TIFF structure from exif of a test jpeg.
+func readTestExif(t *testing.T) []byte {
+	file, err := os.Open("../test/exif-20180101.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	r, err := jpegExifReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func mkPngChunk(typ string, data []byte) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, typ...)
+	chunk = append(chunk, data...)
+	return append(chunk, 0, 0, 0, 0) // crc is not verified
+}
+
+func mkPng(chunks ...[]byte) []byte {
+	data := append([]byte(nil), pngSignature...)
+	data = append(data, mkPngChunk("IHDR", make([]byte, 13))...)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return append(data, mkPngChunk("IEND", nil)...)
+}
+
+func compress(text string) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte(text))
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecodePng(t *testing.T) {
+	exif := readTestExif(t)
+	tests := []struct {
+		name         string
+		data         []byte
+		exif         bool
+		xmp          string
+		creationTime string
+	}{
+		{"tEXt", mkPng(mkPngChunk("tEXt", []byte("Creation Time\x002019-06-26T10:00:00"))), false, "", "2019-06-26T10:00:00"},
+		{"zTXt", mkPng(mkPngChunk("zTXt", append([]byte("Creation Time\x00\x00"), compress("2019:06:26 10:00:00")...))), false, "", "2019:06:26 10:00:00"},
+		{"iTXt", mkPng(mkPngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"))), false, "<x:xmpmeta/>", ""},
+		{"compressed iTXt", mkPng(mkPngChunk("iTXt", append([]byte("Creation Time\x00\x01\x00en\x00\x00"), compress("Wed, 26 Jun 2019 10:00:00 +0200")...))), false, "", "Wed, 26 Jun 2019 10:00:00 +0200"},
+		{"eXIf", mkPng(mkPngChunk("IDAT", make([]byte, 100)), mkPngChunk("eXIf", exif)), true, "", ""},
+		{"other text", mkPng(mkPngChunk("tEXt", []byte("Software\x00GIMP"))), false, "", ""},
+	}
+
+	for _, test := range tests {
+		metadata, err := decodePng(bytes.NewReader(test.data), int64(len(test.data)))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if test.exif != bytes.Equal(metadata.exif, exif) {
+			t.Errorf("%s: unexpected exif: % x", test.name, metadata.exif)
+		}
+		if string(metadata.xmp) != test.xmp {
+			t.Errorf("%s: xmp expected:%s got:%s", test.name, test.xmp, metadata.xmp)
+		}
+		if metadata.creationTime != test.creationTime {
+			t.Errorf("%s: creation time expected:%s got:%s", test.name, test.creationTime, metadata.creationTime)
+		}
+	}
+
+	for _, data := range [][]byte{[]byte("GIF89a\x00\x00"), mkPng(mkPngChunk("tEXt", make([]byte, 10)))[:50]} {
+		if _, err := decodePng(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("expected error for % x", data)
+		}
+	}
+}
+
+func TestParsePngTextLimit(t *testing.T) {
+	bomb := compress(strings.Repeat("0", maxInflatedSize+1))
+	if _, _, err := parsePngText("zTXt", append([]byte("Creation Time\x00\x00"), bomb...)); err == nil {
+		t.Errorf("zTXt: expected error")
+	}
+	if _, _, err := parsePngText("iTXt", append([]byte("Creation Time\x00\x01\x00en\x00\x00"), bomb...)); err == nil {
+		t.Errorf("iTXt: expected error")
+	}
+	text := strings.Repeat("0", maxInflatedSize)
+	if _, got, err := parsePngText("iTXt", append([]byte("Creation Time\x00\x01\x00en\x00\x00"), compress(text)...)); err != nil || got != text {
+		t.Errorf("iTXt at limit: unexpected error: %v", err)
+	}
+}
+
+func TestParsePngCreationTime(t *testing.T) {
+	assumedZone = time.FixedZone("", 3600)
+	defer func() { assumedZone = nil }()
+
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"Wed, 26 Jun 2019 10:00:00 +0200", "2019-06-26T10:00:00+02:00"},
+		{"Wed, 26 Jun 2019 10:00:00 GMT", "2019-06-26T10:00:00Z"},
+		{"2019-06-26T10:00:00+02:00", "2019-06-26T10:00:00+02:00"},
+		{"2019-06-26T10:00:00", "2019-06-26T10:00:00+01:00"},
+		{"2019:06:26 10:00:00", "2019-06-26T10:00:00+01:00"},
+		{" 2019-06-26 10:00:00\n", "2019-06-26T10:00:00+01:00"},
+	}
+	for _, test := range tests {
+		actual, err := parsePngCreationTime(test.value)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.value, err)
+		} else if actual.Format(time.RFC3339) != test.expected {
+			t.Errorf("%s: expected:%s got:%s", test.value, test.expected, actual.Format(time.RFC3339))
+		}
+	}
+
+	if _, err := parsePngCreationTime("yesterday"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestEmbeddedMetadataTimeSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "photo-cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	xmp := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:CreateDate="2019-06-26T10:00:00Z"/>
+</rdf:RDF></x:xmpmeta>`
+	files := map[string][]byte{
+		"screenshot.png": mkPng(mkPngChunk("eXIf", readTestExif(t)), mkPngChunk("tEXt", []byte("Creation Time\x002019-06-26T10:00:00Z"))),
+		"download.webp":  mkWebp(mkRiffChunk("XMP ", []byte(xmp))),
+		"animation.gif":  mkGif(xmp),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	png := mkFakeFile(filepath.Join(dir, "screenshot.png"))
+	png.info = mkInfo(png.path)
+	candidates, err := exifTimeSource{}.Candidates(png)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fields := []string{}
+	for _, candidate := range candidates {
+		fields = append(fields, candidate.field)
+	}
+	if len(candidates) < 2 || fields[len(fields)-1] != pngCreationTimeKeyword {
+		t.Errorf("unexpected candidates: %v", fields)
+	} else if !candidates[len(candidates)-1].time.Equal(time.Date(2019, 6, 26, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected creation time: %s", candidates[len(candidates)-1].time)
+	}
+
+	for _, name := range []string{"download.webp", "animation.gif"} {
+		file := mkFakeFile(filepath.Join(dir, name))
+		file.info = mkInfo(file.path)
+		candidates, err := xmpTimeSource{}.Candidates(file)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+		} else if len(candidates) != 1 || !candidates[0].time.Equal(time.Date(2019, 6, 26, 10, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: unexpected candidates: %v", name, candidates)
+		}
+	}
+}
+
+func TestEmbeddedMetadataTimesInvalidCreationTime(t *testing.T) {
+	embedded := &embeddedMetadata{exif: readTestExif(t), creationTime: "sometime last summer"}
+	times, err := embeddedMetadataTimes(embedded, &fileinfo{path: "screenshot.png"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(times) == 0 {
+		t.Error("exif times are lost")
+	}
+	for _, time := range times {
+		if time.field == pngCreationTimeKeyword {
+			t.Errorf("unexpected creation time: %s", time.time)
+		}
+	}
+}
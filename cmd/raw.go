@@ -0,0 +1,76 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/xor-gate/goexif2/exif"
+)
+
+// rawFileTypes are extensions of TIFF and camera RAW formats which are TIFF
+// containers. IFD0 and Exif IFD are read directly from the file.
+var rawFileTypes = map[string]bool{
+	".tif":  true,
+	".tiff": true,
+	".cr2":  true,
+	".nef":  true,
+	".arw":  true,
+	".dng":  true,
+	".orf":  true,
+	".rw2":  true,
+}
+
+// tiffHeaders maps non-standard TIFF signatures used by some vendors onto
+// standard ones with the same byte order. Layout of the rest of the file is
+// regular TIFF.
+var tiffHeaders = map[string]string{
+	"II*\x00": "II*\x00", // standard little endian; CR2, NEF, ARW, DNG
+	"MM\x00*": "MM\x00*", // standard big endian; NEF, DNG
+	"IIRO":    "II*\x00", // Olympus ORF
+	"IIRS":    "II*\x00", // Olympus ORF
+	"MMOR":    "MM\x00*", // Olympus ORF, big endian
+	"IIU\x00": "II*\x00", // Panasonic RW2
+}
+
+// tiffHeaderReader replaces the first bytes of the underlying reader with
+// header, so that vendor variants are seen by tiff package as regular TIFF.
+type tiffHeaderReader struct {
+	r      io.ReaderAt
+	header []byte
+}
+
+func (this *tiffHeaderReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := this.r.ReadAt(p, off)
+	for i := 0; i < n && off+int64(i) < int64(len(this.header)); i++ {
+		p[i] = this.header[off+int64(i)]
+	}
+	return n, err
+}
+
+// decodeRawExif decodes exif from TIFF based RAW file.
+func decodeRawExif(r io.ReaderAt, size int64) (*exif.Exif, error) {
+	signature := make([]byte, 4)
+	if _, err := r.ReadAt(signature, 0); err != nil {
+		return nil, fmt.Errorf("raw: reading header: %s", err)
+	}
+	header, ok := tiffHeaders[string(signature)]
+	if !ok {
+		return nil, fmt.Errorf("raw: unknown header % x", signature)
+	}
+
+	return decodeTiffExif(io.NewSectionReader(&tiffHeaderReader{r, []byte(header)}, 0, size))
+}
@@ -0,0 +1,69 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/xor-gate/goexif2/exif"
+)
+
+func TestDecodeRawExif(t *testing.T) {
+	tests := []struct {
+		path string
+		make string
+		time string
+	}{
+		{"../test/canon-20160710.cr2", "Canon", "2016-07-10 09:08:07"},
+		{"../test/nikon-20150520.nef", "NIKON CORPORATION", "2015-05-20 10:11:12"},
+		{"../test/sony-20140412.arw", "SONY", "2014-04-12 13:14:15"},
+		{"../test/adobe-20130314.dng", "Ricoh", "2013-03-14 15:16:17"},
+		{"../test/olympus-20120216.orf", "OLYMPUS IMAGING CORP.", "2012-02-16 17:18:19"},
+		{"../test/panasonic-20110118.rw2", "Panasonic", "2011-01-18 19:20:21"},
+	}
+
+	for _, test := range tests {
+		file, err := os.Open(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exinfo, err := decodeRawExif(file, mkInfo(test.path).Size())
+		file.Close()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.path, err)
+			continue
+		}
+
+		if tag, err := exinfo.Get(exif.Make); err != nil {
+			t.Errorf("%s: unexpected error: %s", test.path, err)
+		} else if value, _ := tag.StringVal(); value != test.make {
+			t.Errorf("%s: make expected:%s got:%s", test.path, test.make, value)
+		}
+		if time, err := exinfo.DateTime(); err != nil {
+			t.Errorf("%s: unexpected error: %s", test.path, err)
+		} else if time.Format("2006-01-02 15:04:05") != test.time {
+			t.Errorf("%s: time expected:%s got:%s", test.path, test.time, time)
+		}
+	}
+}
+
+func TestDecodeRawExifUnknownHeader(t *testing.T) {
+	data := []byte("FUJIFILMCCD-RAW ")
+	if _, err := decodeRawExif(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSequenceGap is the largest difference in sequence numbers of files used
+// to infer time.
+var maxSequenceGap int
+
+// sequenceRE splits names like DSC_0123.JPG into prefix and sequence number.
+var sequenceRE = regexp.MustCompile(`^([^[:digit:]]*)([[:digit:]]+)(?:\.[^.]*)?$`)
+
+// sequenceFile is a file numbered by the camera.
+type sequenceFile struct {
+	file   *fileinfo
+	number int
+}
+
+// parseSequenceName returns prefix and sequence number of names like
+// DSC_0123.JPG or IMG0042.jpg.
+func parseSequenceName(name string) (string, int, bool) {
+	match := sequenceRE.FindStringSubmatch(name)
+	if match == nil {
+		return "", 0, false
+	}
+	number, err := strconv.Atoi(match[2])
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.ToLower(match[1]), number, true
+}
+
+// inferSequenceTimes assigns time to undated files by interpolating times of
+// files in the same directory, with the same prefix and nearby sequence
+// numbers. Only files with full precision time are used as reference.
+func inferSequenceTimes(files []*fileinfo) {
+	dated := make(map[string][]sequenceFile)
+	var undated []*fileinfo
+	for _, file := range files {
+		prefix, number, ok := parseSequenceName(file.info.Name())
+		if !ok {
+			continue
+		}
+		if file.time.IsZero() {
+			undated = append(undated, file)
+		} else if file.precision == precisionFull && file.confidence > confidenceInferred {
+			key := filepath.Join(filepath.Dir(file.path), prefix)
+			dated[key] = append(dated[key], sequenceFile{file, number})
+		}
+	}
+	for _, group := range dated {
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].number < group[j].number
+		})
+	}
+
+	for _, file := range undated {
+		prefix, number, _ := parseSequenceName(file.info.Name())
+		group := dated[filepath.Join(filepath.Dir(file.path), prefix)]
+
+		// first dated file with the same or higher number
+		i := sort.Search(len(group), func(i int) bool {
+			return group[i].number >= number
+		})
+		var before, after *sequenceFile
+		if i < len(group) && group[i].number-number <= maxSequenceGap {
+			after = &group[i]
+		}
+		if i > 0 && number-group[i-1].number <= maxSequenceGap {
+			before = &group[i-1]
+		}
+
+		switch {
+		case after != nil && (after.number == number || before == nil):
+			file.time = after.file.time
+			Info("\r%s: time inferred from %s\n", file.path, after.file.path)
+		case before != nil && after == nil:
+			file.time = before.file.time
+			Info("\r%s: time inferred from %s\n", file.path, before.file.path)
+		case before != nil && after != nil:
+			span := after.file.time.Sub(before.file.time)
+			offset := time.Duration(int64(span) / int64(after.number-before.number) * int64(number-before.number))
+			file.time = before.file.time.Add(offset)
+			Info("\r%s: time interpolated between %s and %s\n", file.path, before.file.path, after.file.path)
+		default:
+			continue
+		}
+		file.timeSource = "sequence"
+		file.confidence = confidenceInferred
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSequenceName(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		number int
+		ok     bool
+	}{
+		{"DSC_0123.JPG", "dsc_", 123, true},
+		{"IMG0042.jpg", "img", 42, true},
+		{"P1000001", "p", 1000001, true},
+		{"IMG_20180304_123456.jpg", "", 0, false},
+		{"holiday.jpg", "", 0, false},
+	}
+
+	for _, test := range tests {
+		prefix, number, ok := parseSequenceName(test.name)
+		if prefix != test.prefix || number != test.number || ok != test.ok {
+			t.Errorf("%s: expected:%s %d %t got:%s %d %t", test.name, test.prefix, test.number, test.ok, prefix, number, ok)
+		}
+	}
+}
+
+func TestInferSequenceTimes(t *testing.T) {
+	base := time.Date(2018, 3, 4, 12, 0, 0, 0, time.UTC)
+	dated := func(path string, offset time.Duration) *fileinfo {
+		file := mkFakeFile(path)
+		file.time = base.Add(offset)
+		file.timeSource = "exif"
+		file.confidence = confidenceHigh
+		return file
+	}
+
+	files := []*fileinfo{
+		dated("/card/DSC_0100.JPG", 0),
+		mkFakeFile("/card/DSC_0101.JPG"),
+		mkFakeFile("/card/DSC_0103.JPG"),
+		dated("/card/DSC_0104.JPG", 4*time.Minute),
+		mkFakeFile("/card/dsc_0104.NEF"),
+		mkFakeFile("/card/DSC_0110.JPG"),
+		mkFakeFile("/card/DSC_0120.JPG"),
+		mkFakeFile("/card/IMG_0101.JPG"),
+		mkFakeFile("/other/DSC_0101.JPG"),
+	}
+	imprecise := mkFakeFile("/card/DSC_0200.JPG")
+	imprecise.time = base
+	imprecise.precision = precisionYear
+	imprecise.confidence = confidenceLow
+	files = append(files, imprecise, mkFakeFile("/card/DSC_0201.JPG"))
+
+	inferSequenceTimes(files)
+
+	expected := map[string]time.Time{
+		"/card/DSC_0101.JPG":  base.Add(time.Minute),
+		"/card/DSC_0103.JPG":  base.Add(3 * time.Minute),
+		"/card/dsc_0104.NEF":  base.Add(4 * time.Minute),
+		"/card/DSC_0110.JPG":  base.Add(4 * time.Minute),
+		"/card/DSC_0120.JPG":  {},
+		"/card/IMG_0101.JPG":  {},
+		"/other/DSC_0101.JPG": {},
+		"/card/DSC_0201.JPG":  {},
+	}
+	for _, file := range files {
+		want, ok := expected[file.path]
+		if !ok {
+			continue
+		}
+		if !file.time.Equal(want) {
+			t.Errorf("%s: expected:%s got:%s", file.path, want, file.time)
+		}
+		if !want.IsZero() && (file.timeSource != "sequence" || file.confidence != confidenceInferred) {
+			t.Errorf("%s: unexpected source %s (%s confidence)", file.path, file.timeSource, file.confidence)
+		}
+	}
+}
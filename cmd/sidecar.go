@@ -0,0 +1,245 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sidecarMode tells what happens to sidecars of moved files; "move" moves
+// them along, "drop" deletes them once their contents were consumed.
+var sidecarMode string
+
+var sidecarModes = map[string]bool{
+	"move": true,
+	"drop": true,
+}
+
+// sidecarFile is a file holding meta data of a photo or video, stored next
+// to it.
+type sidecarFile struct {
+	path string
+	// suffix is appended to the new path of the media to get the new path of
+	// the sidecar
+	suffix string
+	// stem is set when suffix replaces the extension of the media
+	stem bool
+	// companion files, e.g. THM thumbnails, are moved even with --sidecars
+	// drop
+	companion bool
+}
+
+// geoLocation is a position on Earth in degrees.
+type geoLocation struct {
+	latitude  float64
+	longitude float64
+}
+
+// addSidecar records sidecar of the file, once.
+func (this *fileinfo) addSidecar(path, suffix string, stem bool) {
+	for _, sidecar := range this.sidecars {
+		if sidecar.path == path {
+			return
+		}
+	}
+	this.sidecars = append(this.sidecars, sidecarFile{path: path, suffix: suffix, stem: stem})
+}
+
+// newPath returns path of the sidecar next to the media moved to mediaPath.
+func (this *sidecarFile) newPath(mediaPath string) string {
+	if this.stem {
+		mediaPath = strings.TrimSuffix(mediaPath, filepath.Ext(mediaPath))
+	}
+	return mediaPath + this.suffix
+}
+
+// moved tells whether the sidecar goes along with its media, rather than
+// being deleted.
+func (this *sidecarFile) moved() bool {
+	return sidecarMode != "drop" || this.companion
+}
+
+// existingSidecarDestination returns the new path of the first sidecar of
+// the file which would overwrite an existing file, or empty string if none
+// would.
+func existingSidecarDestination(file *fileinfo) (string, error) {
+	for _, sidecar := range file.sidecars {
+		if !sidecar.moved() {
+			continue
+		}
+		newPath := sidecar.newPath(file.newPath)
+		if _, err := os.Lstat(newPath); err == nil {
+			return newPath, nil
+		} else if !os.IsNotExist(err) {
+			return "", fmt.Errorf("%s: problem checking destination: %s", newPath, err)
+		}
+	}
+	return "", nil
+}
+
+// sidecarTimeSource reads time from JSON sidecars found in Google Takeout
+// exports. XMP sidecars are read by xmpTimeSource.
+type sidecarTimeSource struct{}
+
+func (sidecarTimeSource) Name() string {
+	return "sidecar"
+}
+
+func (this sidecarTimeSource) Extract(file *fileinfo) (time.Time, confidence, error) {
+	candidates, err := this.Candidates(file)
+	if err != nil {
+		return time.Time{}, confidenceNone, err
+	}
+	return candidates[0].time, candidates[0].confidence, nil
+}
+
+// Candidates returns times from all sidecars of the file.
+func (sidecarTimeSource) Candidates(file *fileinfo) ([]timeCandidate, error) {
+	var candidates []timeCandidate
+
+	if path := findTakeoutSidecar(file.path); path != "" {
+		takeout, err := readTakeoutSidecar(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading sidecar %s (%s)", path, err)
+		}
+		file.setMetadata(metadataDescription, takeout.Description)
+		if location, ok := takeout.location(); ok && file.location == nil {
+			file.location = location
+		}
+		if t, ok := takeout.time(); ok {
+			if assumedZone != nil {
+				t = t.In(assumedZone)
+			} else if file.location != nil {
+				t = t.In(zoneFromLongitude(file.location.longitude))
+			} else {
+				t = t.In(captureZone())
+			}
+			candidates = append(candidates, timeCandidate{
+				source:     "sidecar",
+				field:      "photoTakenTime",
+				time:       t,
+				confidence: confidenceHigh,
+			})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, errNoTime
+	}
+	return candidates, nil
+}
+
+// findSidecars records Takeout JSON and XMP sidecars of the files, whether
+// or not time sources read them. A sidecar found for several files, e.g.
+// JSON of IMG_1234.jpg and IMG_1234-edited.jpg, is recorded only for the one
+// with the shortest name, so that it is moved or dropped once. Companion
+// files have no sidecars of their own.
+func findSidecars(files []*fileinfo) {
+	owners := make(map[string]*fileinfo)
+	sidecars := make(map[string]sidecarFile)
+	var paths []string
+	for _, file := range files {
+		if isCompanionFile(file.path) {
+			continue
+		}
+		found := findXmpSidecars(file.path)
+		if path := findTakeoutSidecar(file.path); path != "" {
+			found = append(found, sidecarFile{path: path, suffix: ".json"})
+		}
+		for _, sidecar := range found {
+			owner, ok := owners[sidecar.path]
+			if !ok {
+				paths = append(paths, sidecar.path)
+			} else if l, r := len(filepath.Base(file.path)), len(filepath.Base(owner.path)); l > r || (l == r && file.path > owner.path) {
+				continue
+			}
+			owners[sidecar.path] = file
+			sidecars[sidecar.path] = sidecar
+		}
+	}
+	for _, path := range paths {
+		sidecar := sidecars[path]
+		owners[path].addSidecar(sidecar.path, sidecar.suffix, sidecar.stem)
+	}
+}
+
+// excludeSidecars leaves in place files which are sidecars of other files,
+// as they are moved or dropped together with their media.
+func excludeSidecars(files []*fileinfo) {
+	sidecars := make(map[string]bool)
+	for _, file := range files {
+		for _, sidecar := range file.sidecars {
+			sidecars[sidecar.path] = true
+		}
+	}
+	for _, file := range files {
+		if sidecars[file.path] {
+			file.newDir = ""
+			file.newPath = ""
+			Info("\r%s: sidecar, handled together with its media\n", file.path)
+		}
+	}
+}
+
+// processSidecars moves or deletes sidecars of the file, which has just been
+// moved to its new path.
+func processSidecars(file *fileinfo) {
+	for _, sidecar := range file.sidecars {
+		if !sidecar.moved() {
+			if dryRun {
+				Print("\rrm %s\n", sidecar.path)
+			} else if err := OS.Remove(sidecar.path); err != nil {
+				Print("\r%s: failed to delete sidecar (%s)\n", sidecar.path, err)
+			}
+			continue
+		}
+
+		newPath := sidecar.newPath(file.newPath)
+		if dryRun {
+			Print("\rmv %s %s\n", sidecar.path, newPath)
+		} else if err := OS.Rename(sidecar.path, newPath); err != nil {
+			Print("\r%s: failed to move sidecar: %s\n", newPath, err)
+		}
+	}
+}
+
+// processDuplicateSidecars moves sidecars of the file, which has just been
+// deleted as a duplicate of the file at its new path, next to that file. If
+// it already has a sidecar of the same name, or with --sidecars drop, they
+// are deleted instead.
+func processDuplicateSidecars(file *fileinfo) {
+	for _, sidecar := range file.sidecars {
+		newPath := sidecar.newPath(file.newPath)
+		_, err := os.Lstat(newPath)
+		if !sidecar.moved() || err == nil {
+			if dryRun {
+				Print("\rrm %s\n", sidecar.path)
+			} else if err := OS.Remove(sidecar.path); err != nil {
+				Print("\r%s: failed to delete sidecar (%s)\n", sidecar.path, err)
+			}
+			continue
+		}
+
+		if dryRun {
+			Print("\rmv %s %s\n", sidecar.path, newPath)
+		} else if err := OS.Rename(sidecar.path, newPath); err != nil {
+			Print("\r%s: failed to move sidecar: %s\n", newPath, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// detectByContent makes file type be determined from file content rather
+// than extension, both when selecting files and when reading meta data.
+var detectByContent bool
+
+// sniffSize is the number of bytes needed to recognize any supported type.
+const sniffSize = 512
+
+// heifBrands are ISO-BMFF major brands of HEIF images.
+var heifBrands = map[string]string{
+	"heic": ".heic",
+	"heix": ".heic",
+	"heim": ".heic",
+	"heis": ".heic",
+	"hevc": ".heic",
+	"hevx": ".heic",
+	"mif1": ".heif",
+	"msf1": ".heif",
+}
+
+// isoMediaBrands are ISO-BMFF major brands of videos. Other brands, e.g. M4A
+// audio, AVIF, JPEG 2000 or Canon CR3, are not supported.
+var isoMediaBrands = map[string]string{
+	"isom": ".mp4",
+	"iso2": ".mp4",
+	"iso4": ".mp4",
+	"iso5": ".mp4",
+	"iso6": ".mp4",
+	"mp41": ".mp4",
+	"mp42": ".mp4",
+	"avc1": ".mp4",
+	"qt  ": ".mov",
+	"M4V ": ".m4v",
+	"M4VH": ".m4v",
+	"M4VP": ".m4v",
+	"3gp4": ".3gp",
+	"3gp5": ".3gp",
+	"3gp6": ".3gp",
+	"3gp7": ".3gp",
+	"3g2a": ".3gp",
+}
+
+// sniffMediaType returns the extension of the type recognized from file
+// signature, or empty string if the content is not a supported type.
+// Plain TIFF containers are reported as .tif, since NEF, ARW and DNG can not
+// be told apart by signature.
+func sniffMediaType(header []byte) string {
+	has := func(offset int, signature string) bool {
+		return len(header) >= offset+len(signature) && string(header[offset:offset+len(signature)]) == signature
+	}
+
+	switch {
+	case has(0, "\xff\xd8\xff"):
+		return ".jpg"
+	case has(0, string(pngSignature)):
+		return ".png"
+	case has(0, "GIF87a") || has(0, "GIF89a"):
+		return ".gif"
+	case has(0, "RIFF") && has(8, "WEBP"):
+		return ".webp"
+	case has(0, "RIFF") && has(8, "AVI "):
+		return ".avi"
+	case has(0, "\x1a\x45\xdf\xa3"):
+		// DocType in EBML header; both are parsed the same way anyway
+		if bytes.Contains(header, []byte("webm")) {
+			return ".webm"
+		}
+		return ".mkv"
+	case has(4, "ftyp") && len(header) >= 12:
+		brand := string(header[8:12])
+		if ext, ok := heifBrands[brand]; ok {
+			return ext
+		}
+		return isoMediaBrands[brand]
+	case len(header) >= 8 && mp4TopLevelBoxes[string(header[4:8])]:
+		// QuickTime files without ftyp
+		return ".mov"
+	case has(0, "II*\x00") && has(8, "CR"):
+		return ".cr2"
+	case has(0, "II*\x00") || has(0, "MM\x00*"):
+		return ".tif"
+	case has(0, "IIRO") || has(0, "IIRS") || has(0, "MMOR"):
+		return ".orf"
+	case has(0, "IIU\x00"):
+		return ".rw2"
+	case len(header) > 188 && header[0] == tsSync && header[188] == tsSync:
+		return ".mts"
+	case len(header) > 196 && header[4] == tsSync && header[196] == tsSync:
+		return ".m2ts"
+	}
+	return ""
+}
+
+// detectMediaType reads the start of the file and recognizes its type.
+func detectMediaType(path string) string {
+	is, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer is.Close()
+
+	header := make([]byte, sniffSize)
+	n, err := io.ReadFull(is, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	return sniffMediaType(header[:n])
+}
+
+// mediaType returns the extension selecting how the file is parsed; with
+// --detect-by-content it is the type recognized from content, unless the
+// content is not recognized.
+func (this *fileinfo) mediaType() string {
+	if this.mediaExt == "" {
+		if detectByContent {
+			this.mediaExt = detectMediaType(this.path)
+		}
+		if this.mediaExt == "" {
+			this.mediaExt = strings.ToLower(filepath.Ext(this.path))
+		}
+	}
+	return this.mediaExt
+}
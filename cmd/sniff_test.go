@@ -0,0 +1,121 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSniffMediaType(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []byte
+		expected string
+	}{
+		{"png", mkPng(), ".png"},
+		{"webp", mkWebp(), ".webp"},
+		{"gif", mkGif(""), ".gif"},
+		{"avi", mkAvi(), ".avi"},
+		{"webm", mkMkv(), ".webm"},
+		{"mts", mkTransportStream(make([]byte, 500), 0x1011, false), ".mts"},
+		{"m2ts", mkTransportStream(make([]byte, 500), 0x1011, true), ".m2ts"},
+		{"mp4", mkMp4Box("ftyp", []byte("isom\x00\x00\x02\x00")), ".mp4"},
+		{"mov", mkMp4Box("ftyp", []byte("qt  \x00\x00\x02\x00")), ".mov"},
+		{"old mov", mkMp4Box("moov"), ".mov"},
+		{"heic", mkMp4Box("ftyp", []byte("heic\x00\x00\x00\x00")), ".heic"},
+		{"cr3", mkMp4Box("ftyp", []byte("crx \x00\x00\x00\x01")), ""},
+		{"m4a", mkMp4Box("ftyp", []byte("M4A \x00\x00\x00\x00")), ""},
+		{"tiff", []byte("MM\x00*\x00\x00\x00\x08"), ".tif"},
+		{"text", []byte("hello world"), ""},
+		{"empty", nil, ""},
+	}
+	for _, test := range tests {
+		if actual := sniffMediaType(test.header); actual != test.expected {
+			t.Errorf("%s: expected:%s got:%s", test.name, test.expected, actual)
+		}
+	}
+
+	files := map[string]string{
+		"../test/jpg.wrong-extension":    ".jpg",
+		"../test/heic-20190615.heic":     ".heic",
+		"../test/quicktime-20190410.mov": ".mov",
+		"../test/mvhd-20190305.mp4":      ".mp4",
+		"../test/canon-20160710.cr2":     ".cr2",
+		"../test/nikon-20150520.nef":     ".tif",
+		"../test/olympus-20120216.orf":   ".orf",
+		"../test/panasonic-20110118.rw2": ".rw2",
+		"../test/empty.jpg":              "",
+	}
+	for path, expected := range files {
+		if actual := detectMediaType(path); actual != expected {
+			t.Errorf("%s: expected:%s got:%s", path, expected, actual)
+		}
+	}
+}
+
+func TestDetectByContent(t *testing.T) {
+	defer func() { detectByContent = false }()
+	allFiles = false
+	hiddenFiles = false
+	minSize = 0
+
+	dir, err := ioutil.TempDir("", "photo-cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data, err := ioutil.ReadFile("../test/exif-20180101.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// jpeg saved as png by messaging app
+	misnamed := filepath.Join(dir, "received.png")
+	if err := ioutil.WriteFile(misnamed, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		detect   bool
+		accepted bool
+	}{
+		{"../test/jpg.wrong-extension", false, false},
+		{"../test/jpg.wrong-extension", true, true},
+		{"../test/empty.jpg", false, true},
+		{"../test/empty.jpg", true, false},
+		{misnamed, true, true},
+	}
+	for _, test := range tests {
+		detectByContent = test.detect
+		if accepted, _ := acceptExifFile(test.path, mkInfo(test.path)); accepted != test.accepted {
+			t.Errorf("%s, detect %v: expected:%v got:%v", test.path, test.detect, test.accepted, accepted)
+		}
+	}
+
+	for _, detect := range []bool{false, true} {
+		detectByContent = detect
+		file := mkFakeFile(misnamed)
+		file.info = mkInfo(misnamed)
+		_, err := exifTimeSource{}.Candidates(file)
+		if detect && err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if !detect && err == nil {
+			t.Error("expected error parsing jpeg as png")
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// takeoutMaxName is the longest name of Takeout sidecar, without .json
+// extension. Longer names are truncated.
+const takeoutMaxName = 46
+
+// takeoutCounterRE matches names of duplicates, e.g. IMG_1234(1).JPG, whose
+// sidecars are named IMG_1234.JPG(1).json.
+var takeoutCounterRE = regexp.MustCompile(`^(.*)(\([[:digit:]]+\))(\.[^.]*)$`)
+
+// takeoutEditedSuffix is appended to names of photos edited in Google Photos.
+// They share the sidecar of the original.
+const takeoutEditedSuffix = "-edited"
+
+type takeoutTime struct {
+	Timestamp string `json:"timestamp"`
+}
+
+type takeoutGeoData struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"`
+}
+
+// takeoutMetadata is the contents of Google Takeout JSON sidecar.
+type takeoutMetadata struct {
+	Title          string         `json:"title"`
+	Description    string         `json:"description"`
+	PhotoTakenTime takeoutTime    `json:"photoTakenTime"`
+	GeoData        takeoutGeoData `json:"geoData"`
+	GeoDataExif    takeoutGeoData `json:"geoDataExif"`
+}
+
+// time returns the capture time, if present.
+func (this *takeoutMetadata) time() (time.Time, bool) {
+	seconds, err := strconv.ParseInt(this.PhotoTakenTime.Timestamp, 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0).UTC(), true
+}
+
+// location returns the position, preferring the one edited by the user over
+// the one from exif. Zero coordinates mean no position.
+func (this *takeoutMetadata) location() (*geoLocation, bool) {
+	for _, geo := range []takeoutGeoData{this.GeoData, this.GeoDataExif} {
+		if geo.Latitude != 0 || geo.Longitude != 0 {
+			return &geoLocation{geo.Latitude, geo.Longitude}, true
+		}
+	}
+	return nil, false
+}
+
+func readTakeoutSidecar(path string) (*takeoutMetadata, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var metadata takeoutMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+// truncateName shortens name to at most max characters.
+func truncateName(name string, max int) string {
+	runes := []rune(name)
+	if len(runes) > max {
+		return string(runes[:max])
+	}
+	return name
+}
+
+// takeoutSidecarNames returns names the sidecar of the media may have, most
+// likely first. Takeout truncates long names, moves duplicate counter behind
+// the extension and shares sidecars of edited photos with the originals.
+func takeoutSidecarNames(name string) []string {
+	counter := ""
+	if match := takeoutCounterRE.FindStringSubmatch(name); match != nil {
+		name = match[1] + match[3]
+		counter = match[2]
+	}
+	names := []string{name}
+	ext := filepath.Ext(name)
+	if stem := strings.TrimSuffix(name, ext); strings.HasSuffix(stem, takeoutEditedSuffix) {
+		names = append(names, strings.TrimSuffix(stem, takeoutEditedSuffix)+ext)
+	}
+
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		for _, base := range []string{name, name + ".supplemental-metadata", stem} {
+			for _, candidate := range []string{
+				base + counter + ".json",
+				truncateName(base, takeoutMaxName) + counter + ".json",
+			} {
+				if !seen[candidate] {
+					seen[candidate] = true
+					candidates = append(candidates, candidate)
+				}
+			}
+		}
+	}
+	return candidates
+}
+
+// findTakeoutSidecar returns path of Takeout sidecar of the media, or empty
+// string if there is none.
+func findTakeoutSidecar(path string) string {
+	dir, name := filepath.Split(path)
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		return ""
+	}
+	for _, candidate := range takeoutSidecarNames(name) {
+		candidate = filepath.Join(dir, candidate)
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+			return candidate
+		}
+	}
+	return ""
+}
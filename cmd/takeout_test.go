@@ -0,0 +1,213 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const takeoutSidecar = `{
+  "title": "IMG_1234.jpg",
+  "description": "Plitvice",
+  "photoTakenTime": {"timestamp": "1561543200", "formatted": "Jun 26, 2019, 10:00:00 AM UTC"},
+  "geoData": {"latitude": 0.0, "longitude": 0.0, "altitude": 0.0},
+  "geoDataExif": {"latitude": 44.8654, "longitude": 15.5820, "altitude": 500.0}
+}`
+
+func TestTakeoutSidecarNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"IMG_1234.jpg", "IMG_1234.jpg.json"},
+		{"IMG_1234(1).jpg", "IMG_1234.jpg(1).json"},
+		{"IMG_1234-edited.jpg", "IMG_1234.jpg.json"},
+		{"IMG_1234.jpg", "IMG_1234.jpg.supplemental-metadata.json"},
+		{"IMG_1234.jpg", "IMG_1234.json"},
+		{"Screenshot_20190626-100000_Very_Long_Application.jpg", "Screenshot_20190626-100000_Very_Long_Applicati.json"},
+		{"Screenshot_20190626-100000_Very_Long_Application(2).jpg", "Screenshot_20190626-100000_Very_Long_Applicati(2).json"},
+	}
+
+	for _, test := range tests {
+		found := false
+		for _, name := range takeoutSidecarNames(test.name) {
+			if name == test.expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: %s not among %v", test.name, test.expected, takeoutSidecarNames(test.name))
+		}
+	}
+}
+
+func TestTakeoutSidecar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "takeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, contents := range map[string]string{
+		"IMG_1234(1).jpg":      "not a jpeg",
+		"IMG_1234.jpg(1).json": takeoutSidecar,
+		"IMG_1235.jpg":         "not a jpeg",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func() {
+		sidecarMode = "move"
+		dryRun = false
+	}()
+	setDirectoryFormat(t, "yyyy/mm/dd")
+	allFiles = false
+	minSize = 0
+
+	files, err := getFiles(dir, acceptExifFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("unexpected files: %v", files)
+	}
+	evaluate(files, "dest")
+	excludeSidecars(files)
+
+	file := files[0]
+	if file.info.Name() != "IMG_1234(1).jpg" {
+		file = files[1]
+	}
+	expected := time.Date(2019, 6, 26, 10, 0, 0, 0, time.UTC)
+	if file.timeSource != "sidecar" || !file.time.Equal(expected) {
+		t.Errorf("unexpected time: %s from %s", file.time, file.timeSource)
+	}
+	if _, offset := file.time.Zone(); offset != 3600 {
+		t.Errorf("unexpected zone offset: %d", offset)
+	}
+	if file.location == nil || file.location.latitude != 44.8654 {
+		t.Errorf("unexpected location: %v", file.location)
+	}
+	if file.metadata[metadataDescription] != "Plitvice" {
+		t.Errorf("unexpected description: %v", file.metadata)
+	}
+	if file.newPath != "dest/2019/06/26/IMG_1234(1).jpg" {
+		t.Errorf("unexpected newPath: %s", file.newPath)
+	}
+	if len(file.sidecars) != 1 || file.sidecars[0].path != filepath.Join(dir, "IMG_1234.jpg(1).json") {
+		t.Fatalf("unexpected sidecars: %v", file.sidecars)
+	}
+
+	dryRun = false
+	sidecarMode = "move"
+	OS := initMockOs()
+	processSidecars(file)
+	if OS.rename.called != 1 || OS.rename.newpath != "dest/2019/06/26/IMG_1234(1).jpg.json" {
+		t.Errorf("unexpected rename (%d): %s", OS.rename.called, OS.rename.newpath)
+	}
+
+	sidecarMode = "drop"
+	OS = initMockOs()
+	processSidecars(file)
+	if OS.remove.called != 1 || OS.remove.path != file.sidecars[0].path {
+		t.Errorf("unexpected remove (%d): %s", OS.remove.called, OS.remove.path)
+	}
+}
+
+func TestTakeoutSidecarAssumedZone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "takeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "IMG_1234.jpg.json"), []byte(takeoutSidecar), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// --assume-tz wins over the zone estimated from the longitude
+	assumedZone = time.FixedZone("", -5*3600)
+	defer func() { assumedZone = nil }()
+
+	file := &fileinfo{path: filepath.Join(dir, "IMG_1234.jpg")}
+	candidates, err := sidecarTimeSource{}.Candidates(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if file.location == nil {
+		t.Errorf("location not read")
+	}
+	if _, offset := candidates[0].time.Zone(); offset != -5*3600 {
+		t.Errorf("unexpected zone offset: %d", offset)
+	}
+}
+
+func TestFindSidecars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "takeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"IMG_1234.jpg", "IMG_1234-edited.jpg", "IMG_1234.jpg.json", "dest/IMG_1234.jpg.json"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(takeoutSidecar), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// found even when sidecar time source is not used, and only for one of
+	// the files sharing it
+	edited := &fileinfo{path: filepath.Join(dir, "IMG_1234-edited.jpg")}
+	original := &fileinfo{path: filepath.Join(dir, "IMG_1234.jpg")}
+	findSidecars([]*fileinfo{edited, original})
+	if len(edited.sidecars) != 0 {
+		t.Errorf("unexpected sidecars of edited file: %v", edited.sidecars)
+	}
+	if len(original.sidecars) != 1 || original.sidecars[0].path != filepath.Join(dir, "IMG_1234.jpg.json") {
+		t.Fatalf("unexpected sidecars: %v", original.sidecars)
+	}
+
+	defer func() {
+		sidecarMode = "move"
+		dryRun = false
+	}()
+	dryRun = false
+	sidecarMode = "move"
+
+	// duplicate of a file which has its own sidecar already
+	original.newPath = filepath.Join(dir, "dest/IMG_1234.jpg")
+	OS := initMockOs()
+	processDuplicateSidecars(original)
+	if OS.remove.called != 1 || OS.rename.called != 0 || OS.remove.path != original.sidecars[0].path {
+		t.Errorf("unexpected remove (%d) and rename (%d): %s", OS.remove.called, OS.rename.called, OS.remove.path)
+	}
+
+	// duplicate of a file without sidecar
+	original.newPath = filepath.Join(dir, "dest/IMG_1234-1.jpg")
+	OS = initMockOs()
+	processDuplicateSidecars(original)
+	if OS.rename.called != 1 || OS.rename.newpath != filepath.Join(dir, "dest/IMG_1234-1.jpg.json") {
+		t.Errorf("unexpected rename (%d): %s", OS.rename.called, OS.rename.newpath)
+	}
+}
@@ -14,41 +14,217 @@
 
 package cmd
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
 
-// TimeFormat creates format string for time.Format() using yyyy etc notation.
-//
-// I prefer setting the format for time.Format() using familiar yyyy, mmm etc.
-// notation rather then example based one in Go. In particular this is useful
-// when exposing the format to users, e.g. on the command line.
+// timeToken is a letter sequence of time format, e.g. yyyy.
+type timeToken struct {
+	name   string
+	layout string // Go layout with the same meaning, empty if there is none
+	format func(t time.Time) string
+}
+
+// timeTokens are all known tokens; longer tokens come before their
+// prefixes.
+var timeTokens = []timeToken{
+	{"yyyy", "2006", nil},
+	{"yy", "06", nil},
+	{"GGGG", "", func(t time.Time) string {
+		year, _ := t.ISOWeek()
+		return fmt.Sprintf("%04d", year)
+	}},
+	{"Q", "", func(t time.Time) string {
+		return fmt.Sprintf("%d", (int(t.Month())-1)/3+1)
+	}},
+	{"mmmm", "January", nil},
+	{"mmm", "Jan", nil},
+	{"mm", "01", nil},
+	{"m", "1", nil},
+	{"ww", "", func(t time.Time) string {
+		_, week := t.ISOWeek()
+		return fmt.Sprintf("%02d", week)
+	}},
+	{"dddd", "Monday", nil},
+	{"ddd", "Mon", nil},
+	{"dd", "02", nil},
+	{"d", "2", nil},
+	{"jjj", "", func(t time.Time) string {
+		return fmt.Sprintf("%03d", t.YearDay())
+	}},
+	{"HHT", "03", nil}, // kept for compatibility, same as hh
+	{"HH", "15", nil},
+	{"H", "", func(t time.Time) string {
+		return fmt.Sprintf("%d", t.Hour())
+	}},
+	{"hh", "03", nil},
+	{"h", "3", nil},
+	{"MM", "04", nil},
+	{"SS", "05", nil},
+	{"ss", "05", nil},
+	{"tt", "PM", nil},
+	{"ZZZ", "MST", nil},
+	{"Z", "MST", nil},
+}
+
+// findTimeToken returns the token with the name, or nil if there is none.
+func findTimeToken(name string) *timeToken {
+	for i := range timeTokens {
+		if timeTokens[i].name == name {
+			return &timeTokens[i]
+		}
+	}
+	return nil
+}
+
+// timeFormatElement is either a token or literal text.
+type timeFormatElement struct {
+	token   *timeToken
+	literal string
+}
+
+// timeFormat is parsed time format in yyyy etc. notation.
 //
-// TODO: Allow escaping of characters.
-func TimeFormat(format string) string {
-	patterns := []struct {
-		from string
-		to   string
-	}{
-		{"yyyy", "2006"},
-		{"yy", "06"},
-		{"mmmm", "January"},
-		{"mmm", "Jan"},
-		{"mm", "01"},
-		{"dddd", "Monday"},
-		{"ddd", "Mon"},
-		{"dd", "02"},
-		{"HHT", "03"},
-		{"HH", "15"},
-		{"MM", "04"},
-		{"SS", "05"},
-		{"ss", "05"},
-		{"tt", "PM"},
-		{"ZZZ", "MST"},
-		{"Z", "MST"},
-	}
-
-	retVal := format
-	for _, pattern := range patterns {
-		retVal = strings.Replace(retVal, pattern.from, pattern.to, -1)
-	}
-	return retVal
+// I prefer setting time formats using familiar yyyy, mmm etc. notation rather
+// then example based one in Go. In particular this is useful when exposing
+// the format to users, e.g. on the command line.
+type timeFormat []timeFormatElement
+
+// parseTimeFormat splits the format into tokens and literal text. Text in
+// single quotes is literal, with two quotes standing for the quote itself.
+// Other characters than letters are always literal, while letters which are
+// not part of any token are rejected, so that e.g. "Summer" is not mistaken
+// for a month; it has to be given as 'Summer'.
+func parseTimeFormat(format string) (timeFormat, error) {
+	var result timeFormat
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			result = append(result, timeFormatElement{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	// position returns one based position of the character at offset i.
+	position := func(i int) int {
+		return utf8.RuneCountInString(format[:i]) + 1
+	}
+
+NEXT:
+	for i := 0; i < len(format); {
+		if format[i] == '\'' {
+			start := i
+			for i++; ; i++ {
+				if i == len(format) {
+					return nil, fmt.Errorf("unterminated quote at position %d of '%s'", position(start), format)
+				}
+				if format[i] != '\'' {
+					literal.WriteByte(format[i])
+				} else if strings.HasPrefix(format[i:], "''") && i > start+1 {
+					// doubled quote within quoted text
+					literal.WriteByte('\'')
+					i++
+				} else {
+					break
+				}
+			}
+			if i == start+1 {
+				// '' outside quoted text
+				literal.WriteByte('\'')
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(format[i:])
+		if !unicode.IsLetter(r) {
+			literal.WriteString(format[i : i+size])
+			i += size
+			continue
+		}
+		for j := range timeTokens {
+			if strings.HasPrefix(format[i:], timeTokens[j].name) {
+				flush()
+				result = append(result, timeFormatElement{token: &timeTokens[j]})
+				i += len(timeTokens[j].name)
+				continue NEXT
+			}
+		}
+		return nil, fmt.Errorf("unknown token '%c' at position %d of '%s'; put literal text in single quotes", r, position(i), format)
+	}
+	flush()
+	return result, nil
+}
+
+// Format returns time formatted according to the format.
+func (this timeFormat) Format(t time.Time) string {
+	return this.FormatLocale(t, nil)
+}
+
+// FormatLocale returns time formatted according to the format, with month
+// and weekday names of the locale; nil locale gives English names.
+func (this timeFormat) FormatLocale(t time.Time, locale *timeLocale) string {
+	var result strings.Builder
+	for _, element := range this {
+		if element.token != nil && locale != nil {
+			if name, ok := locale.name(element.token.name, t); ok {
+				result.WriteString(name)
+				continue
+			}
+		}
+		switch {
+		case element.token == nil:
+			result.WriteString(element.literal)
+		case element.token.format != nil:
+			result.WriteString(element.token.format(t))
+		default:
+			result.WriteString(t.Format(element.token.layout))
+		}
+	}
+	return result.String()
+}
+
+// layout returns Go layout equivalent to the format, for use with
+// time.Parse(). Go layouts can not escape text, so literal text must not
+// contain digits or words Go would take for time, e.g. Jan or PM.
+func (this timeFormat) layout() (string, error) {
+	var result strings.Builder
+	for _, element := range this {
+		if element.token != nil {
+			if element.token.layout == "" {
+				return "", fmt.Errorf("%s can not be used for parsing", element.token.name)
+			}
+			result.WriteString(element.token.layout)
+			continue
+		}
+		if strings.ContainsAny(element.literal, "0123456789") {
+			return "", fmt.Errorf("literal '%s' can not contain digits when parsing", element.literal)
+		}
+		for _, word := range []string{"Jan", "Mon", "MST", "PM", "pm"} {
+			if strings.Contains(element.literal, word) {
+				return "", fmt.Errorf("literal '%s' can not contain '%s' when parsing", element.literal, word)
+			}
+		}
+		result.WriteString(element.literal)
+	}
+	return result.String(), nil
+}
+
+// isTimeFormat returns true if the text is a valid time format with at
+// least one token, e.g. yyyymmdd.
+func isTimeFormat(text string) bool {
+	format, err := parseTimeFormat(text)
+	if err != nil {
+		return false
+	}
+	for _, element := range format {
+		if element.token != nil {
+			return true
+		}
+	}
+	return false
 }
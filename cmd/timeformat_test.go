@@ -0,0 +1,148 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeFormat(t *testing.T) {
+	zone := time.FixedZone("CET", 3600)
+	// Sunday, belongs to the last ISO week of 2020
+	sunday := time.Date(2021, 1, 3, 15, 4, 5, 0, zone)
+	morning := time.Date(2019, 11, 28, 8, 7, 6, 0, zone)
+
+	tests := []struct {
+		format   string
+		time     time.Time
+		expected string
+	}{
+		{"yyyy", sunday, "2021"},
+		{"yy", sunday, "21"},
+		{"GGGG", sunday, "2020"},
+		{"GGGG", morning, "2019"},
+		{"Q", sunday, "1"},
+		{"Q", morning, "4"},
+		{"mmmm", sunday, "January"},
+		{"mmm", sunday, "Jan"},
+		{"mm", sunday, "01"},
+		{"m", sunday, "1"},
+		{"m", morning, "11"},
+		{"ww", sunday, "53"},
+		{"ww", morning, "48"},
+		{"dddd", sunday, "Sunday"},
+		{"ddd", sunday, "Sun"},
+		{"dd", sunday, "03"},
+		{"d", sunday, "3"},
+		{"d", morning, "28"},
+		{"jjj", sunday, "003"},
+		{"jjj", morning, "332"},
+		{"HHT", sunday, "03"},
+		{"HH", sunday, "15"},
+		{"HH", morning, "08"},
+		{"H", sunday, "15"},
+		{"H", morning, "8"},
+		{"hh", sunday, "03"},
+		{"h", sunday, "3"},
+		{"MM", sunday, "04"},
+		{"SS", sunday, "05"},
+		{"ss", sunday, "05"},
+		{"tt", sunday, "PM"},
+		{"tt", morning, "AM"},
+		{"ZZZ", sunday, "CET"},
+		{"Z", sunday, "CET"},
+		{"yyyy/mm", sunday, "2021/01"},
+		{"yyyy-mm-dd HH.MM.SS", sunday, "2021-01-03 15.04.05"},
+		{"GGGG-'W'ww", sunday, "2020-W53"},
+		{"yyyy 'Q'Q", morning, "2019 Q4"},
+		{"h:MM tt", morning, "8:07 AM"},
+		{"yyyy/'Summer'", sunday, "2021/Summer"},
+		{"yyyy/'mm dd'", sunday, "2021/mm dd"},
+		{"'it''s' yyyy", sunday, "it's 2021"},
+		{"yyyy''mm", sunday, "2021'01"},
+		{"''", sunday, "'"},
+		{"", sunday, ""},
+	}
+
+	for _, test := range tests {
+		format, err := parseTimeFormat(test.format)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.format, err)
+			continue
+		}
+		if got := format.Format(test.time); got != test.expected {
+			t.Errorf("%s: expected:%s got:%s", test.format, test.expected, got)
+		}
+	}
+}
+
+func TestParseTimeFormatErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		err    string
+	}{
+		{"yyyy/Summer", "unknown token 'S' at position 6 of 'yyyy/Summer'"},
+		{"yyyy/mm/Trip", "unknown token 'T' at position 9 of 'yyyy/mm/Trip'"},
+		{"yyy", "unknown token 'y' at position 3 of 'yyy'"},
+		{"ćyyyy/x", "unknown token 'ć' at position 1 of 'ćyyyy/x'"},
+		{"yyyy/ć", "unknown token 'ć' at position 6 of 'yyyy/ć'"},
+		{"yyyy 'Trip", "unterminated quote at position 6 of 'yyyy 'Trip'"},
+		{"'it''s", "unterminated quote at position 1 of ''it''s'"},
+	}
+
+	for _, test := range tests {
+		_, err := parseTimeFormat(test.format)
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("%s: expected error:%s got:%v", test.format, test.err, err)
+		}
+	}
+}
+
+func TestTimeFormatLayout(t *testing.T) {
+	tests := []struct {
+		format string
+		layout string
+		err    string
+	}{
+		{"yyyymmdd_HHMMSS", "20060102_150405", ""},
+		{"yyyy-mm-dd 'at' h.MM.SS tt", "2006-01-02 at 3.04.05 PM", ""},
+		{"d.m.yy", "2.1.06", ""},
+		{"mmm dd, yyyy", "Jan 02, 2006", ""},
+		{"yyyy-'W'ww", "", "ww can not be used for parsing"},
+		{"yyyyjjj", "", "jjj can not be used for parsing"},
+		{"'1'yyyy", "", "literal '1' can not contain digits"},
+		{"yyyy 'Mon'", "", "literal ' Mon' can not contain 'Mon'"},
+	}
+
+	for _, test := range tests {
+		format, err := parseTimeFormat(test.format)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.format, err)
+			continue
+		}
+		layout, err := format.layout()
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("%s: expected error:%s got:%v", test.format, test.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.format, err)
+		} else if layout != test.layout {
+			t.Errorf("%s: expected:%s got:%s", test.format, test.layout, layout)
+		}
+	}
+}
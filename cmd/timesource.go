@@ -0,0 +1,406 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// confidence describes how much the time determined by a TimeSource can be
+// trusted.
+type confidence int
+
+const (
+	confidenceNone     confidence = iota
+	confidenceInferred            // interpolated from neighbouring files
+	confidenceLow                 // file system times, easily changed by copying
+	confidenceMedium              // time encoded in file name
+	confidenceHigh                // time embedded in file meta data
+)
+
+func (c confidence) String() string {
+	switch c {
+	case confidenceInferred:
+		return "inferred"
+	case confidenceLow:
+		return "low"
+	case confidenceMedium:
+		return "medium"
+	case confidenceHigh:
+		return "high"
+	default:
+		return "none"
+	}
+}
+
+// timePrecision tells how precisely a time is known. Times with precision
+// coarser than full stand for the beginning of the period, e.g. the first day
+// of the month.
+type timePrecision int
+
+const (
+	precisionFull timePrecision = iota // as precise as the source records it
+	precisionDay
+	precisionMonth
+	precisionYear
+)
+
+func (p timePrecision) String() string {
+	switch p {
+	case precisionDay:
+		return "day"
+	case precisionMonth:
+		return "month"
+	case precisionYear:
+		return "year"
+	default:
+		return "full"
+	}
+}
+
+// periodEnd returns the last instant of the period starting at t.
+func (p timePrecision) periodEnd(t time.Time) time.Time {
+	switch p {
+	case precisionDay:
+		return t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	case precisionMonth:
+		return t.AddDate(0, 1, 0).Add(-time.Nanosecond)
+	case precisionYear:
+		return t.AddDate(1, 0, 0).Add(-time.Nanosecond)
+	default:
+		return t
+	}
+}
+
+// TimeSource determines the time a photo or video was taken using one source
+// of information, e.g. exif or file name. Extract returns errNoTime when the
+// source has no time for the file. Any other error is reported to the user
+// before the next source is tried.
+type TimeSource interface {
+	Name() string
+	Extract(file *fileinfo) (time.Time, confidence, error)
+}
+
+var errNoTime = errors.New("no time found")
+
+// timeCandidate is a time found by one of the time sources.
+type timeCandidate struct {
+	source     string // name of the time source
+	field      string // field within the source, e.g. exif field name
+	time       time.Time
+	precision  timePrecision
+	confidence confidence
+	correction time.Duration // offset applied by clock rule
+}
+
+// distance returns how far apart the periods of two candidates are, zero if
+// they overlap.
+func (this timeCandidate) distance(other timeCandidate) time.Duration {
+	if d := other.time.Sub(this.precision.periodEnd(this.time)); d > 0 {
+		return d
+	}
+	if d := this.time.Sub(other.precision.periodEnd(other.time)); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func (this timeCandidate) String() string {
+	name := this.source
+	if this.field != "" {
+		name += ":" + this.field
+	}
+	if this.precision != precisionFull {
+		return fmt.Sprintf("%s %s (%s precision)", name, this.time, this.precision)
+	}
+	return fmt.Sprintf("%s %s", name, this.time)
+}
+
+// timeCandidateSource is implemented by time sources which may find more than
+// one time for a file, e.g. in different exif fields. Candidates are
+// returned most preferred first.
+type timeCandidateSource interface {
+	Candidates(file *fileinfo) ([]timeCandidate, error)
+}
+
+// timeSourcePreparer is implemented by time sources which need to see all
+// files before extracting time of individual ones.
+type timeSourcePreparer interface {
+	Prepare(files []*fileinfo)
+}
+
+// defaultTimeSources is the order in which sources are consulted unless
+// changed with --time-sources.
+var defaultTimeSources = []string{"exif", "sidecar", "xmp", "filename", "dirname", "btime", "mtime"}
+
+var timeSourceNames = defaultTimeSources
+
+// conflictThreshold is the largest difference between times from different
+// sources which are still considered to agree.
+var conflictThreshold = 24 * time.Hour
+
+// skipConflicts leaves files with conflicting times in place.
+var skipConflicts bool
+
+// plausibleSince is the earliest accepted capture time. Earlier times are
+// most likely reset clocks or corrupt meta data.
+var plausibleSince = time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// plausibleFutureSlack allows times slightly in the future, as recorded by
+// clocks in time zones ahead of ours.
+const plausibleFutureSlack = 24 * time.Hour
+
+// timeSourceRegistry holds all known time sources keyed by name.
+var timeSourceRegistry = map[string]TimeSource{}
+
+// timeSourceSwitches are flags which can turn individual sources off without
+// changing the order given by --time-sources.
+var timeSourceSwitches = map[string]*bool{
+	"exif":     &useExifTime,
+	"sidecar":  &useSidecarTime,
+	"xmp":      &useXmpTime,
+	"filename": &useFilenameEncodedTime,
+	"dirname":  &useDirnameTime,
+	"btime":    &useBirthTime,
+	"mtime":    &useFileTime,
+}
+
+func registerTimeSource(source TimeSource) {
+	timeSourceRegistry[source.Name()] = source
+}
+
+// lookupTimeSources returns time sources in the requested order.
+func lookupTimeSources(names []string) ([]TimeSource, error) {
+	sources := make([]TimeSource, 0, len(names))
+	for _, name := range names {
+		source, ok := timeSourceRegistry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown time source '%s' (available: %s)", name, availableTimeSources())
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// activeTimeSources returns time sources in the order given by
+// --time-sources, without those turned off by their switch.
+func activeTimeSources() ([]TimeSource, error) {
+	sources, err := lookupTimeSources(timeSourceNames)
+	if err != nil {
+		return nil, err
+	}
+	active := sources[:0]
+	for _, source := range sources {
+		if enabled, ok := timeSourceSwitches[source.Name()]; ok && !*enabled {
+			continue
+		}
+		active = append(active, source)
+	}
+	return active, nil
+}
+
+func availableTimeSources() string {
+	names := make([]string, 0, len(timeSourceRegistry))
+	for name := range timeSourceRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// determineTime consults all sources and picks the time most of them agree
+// on. Ties are resolved in favour of the source consulted first. Returns
+// false if no source could determine a plausible time.
+func determineTime(file *fileinfo, sources []TimeSource) bool {
+	file.candidates = collectTimeCandidates(file, sources)
+	best, conflict := selectTimeCandidate(file.candidates)
+	if best == nil {
+		return false
+	}
+	file.time = best.time
+	file.precision = best.precision
+	file.timeSource = best.source
+	file.confidence = best.confidence
+	file.clockCorrection = best.correction
+	file.conflict = conflict
+	return true
+}
+
+// collectTimeCandidates returns plausible times found by sources, in source
+// order.
+func collectTimeCandidates(file *fileinfo, sources []TimeSource) []timeCandidate {
+	var candidates []timeCandidate
+	for _, source := range sources {
+		var found []timeCandidate
+		var err error
+		if multi, ok := source.(timeCandidateSource); ok {
+			found, err = multi.Candidates(file)
+		} else {
+			var time time.Time
+			var conf confidence
+			time, conf, err = source.Extract(file)
+			found = []timeCandidate{{source: source.Name(), time: time, confidence: conf}}
+		}
+		if err != nil {
+			if err != errNoTime {
+				Info("\r%s: %s\n", file.path, err)
+			}
+			continue
+		}
+
+		for _, candidate := range found {
+			correctClock(file, &candidate)
+			if !isPlausibleTime(candidate.time) {
+				Info("\r%s: ignoring implausible time %s\n", file.path, candidate)
+				continue
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+func isPlausibleTime(t time.Time) bool {
+	return !t.Before(plausibleSince) && t.Before(time.Now().Add(plausibleFutureSlack))
+}
+
+// selectTimeCandidate returns the candidate agreeing with the most other
+// sources, and whether sources with better than low confidence disagree by
+// more than conflictThreshold.
+func selectTimeCandidate(candidates []timeCandidate) (*timeCandidate, bool) {
+	var best *timeCandidate
+	bestSupport := -1
+	for i := range candidates {
+		agreeing := make(map[string]bool)
+		for _, other := range candidates {
+			if other.source != candidates[i].source && other.distance(candidates[i]) <= conflictThreshold {
+				agreeing[other.source] = true
+			}
+		}
+		if len(agreeing) > bestSupport {
+			best = &candidates[i]
+			bestSupport = len(agreeing)
+		}
+	}
+
+	conflict := false
+	for i, a := range candidates {
+		for _, b := range candidates[i+1:] {
+			if a.source != b.source && a.confidence > confidenceLow && b.confidence > confidenceLow &&
+				a.distance(b) > conflictThreshold {
+				conflict = true
+			}
+		}
+	}
+	return best, conflict
+}
+
+// reportConflicts lists files whose sources disagree, so that they can be
+// reviewed.
+func reportConflicts(files []*fileinfo) {
+	var conflicts []*fileinfo
+	for _, file := range files {
+		if file.conflict {
+			conflicts = append(conflicts, file)
+		}
+	}
+	if len(conflicts) == 0 {
+		return
+	}
+
+	Print("%d files have times which disagree by more than %s:\n", len(conflicts), conflictThreshold)
+	for _, file := range conflicts {
+		Print("%s:\n", file.path)
+		for _, candidate := range file.candidates {
+			marker := " "
+			if candidate.source == file.timeSource && candidate.time.Equal(file.time) {
+				marker = "*"
+			}
+			Print("  %s %s (%s confidence)\n", marker, candidate, candidate.confidence)
+		}
+	}
+}
+
+func init() {
+	registerTimeSource(exifTimeSource{})
+	registerTimeSource(sidecarTimeSource{})
+	registerTimeSource(xmpTimeSource{})
+	registerTimeSource(&filenameTimeSource{})
+	registerTimeSource(dirnameTimeSource{})
+	registerTimeSource(btimeTimeSource{})
+	registerTimeSource(mtimeTimeSource{})
+}
+
+// exifTimeSource reads time from meta data embedded in the file; exif for
+// images and movie header for videos.
+type exifTimeSource struct{}
+
+func (exifTimeSource) Name() string {
+	return "exif"
+}
+
+func (this exifTimeSource) Extract(file *fileinfo) (time.Time, confidence, error) {
+	candidates, err := this.Candidates(file)
+	if err != nil {
+		return time.Time{}, confidenceNone, err
+	}
+	return candidates[0].time, candidates[0].confidence, nil
+}
+
+// Candidates returns times from all exif time fields.
+func (exifTimeSource) Candidates(file *fileinfo) ([]timeCandidate, error) {
+	is, err := os.Open(file.path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file (%s)", err)
+	}
+	defer func() {
+		if err := is.Close(); err != nil {
+			Print("\r%s: unexpected error closing read stream (%s)\n", file.path, err)
+		}
+	}()
+
+	times, err := readMetadataTimes(is, file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading meta data (%s)", err)
+	} else if len(times) == 0 {
+		return nil, errNoTime
+	}
+	candidates := make([]timeCandidate, 0, len(times))
+	for _, t := range times {
+		candidates = append(candidates, timeCandidate{
+			source:     "exif",
+			field:      t.field,
+			time:       t.time,
+			confidence: confidenceHigh,
+		})
+	}
+	return candidates, nil
+}
+
+// mtimeTimeSource uses file modification time.
+type mtimeTimeSource struct{}
+
+func (mtimeTimeSource) Name() string {
+	return "mtime"
+}
+
+func (mtimeTimeSource) Extract(file *fileinfo) (time.Time, confidence, error) {
+	return file.info.ModTime().In(captureZone()), confidenceLow, nil
+}
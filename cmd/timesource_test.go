@@ -0,0 +1,149 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeSourceOrder(t *testing.T) {
+	tests := []struct {
+		path       string
+		sources    []string
+		useMtime   bool
+		newPath    string
+		timeSource string
+		confidence confidence
+	}{
+		{"../test/exif-20170202.jpg", []string{"exif", "filename", "mtime"}, true, "dest/2017/02/exif-20170202.jpg", "exif", confidenceHigh},
+		{"../test/no-exif.jpg", []string{"exif", "filename", "mtime"}, true, "dest/2018/01/no-exif.jpg", "mtime", confidenceLow},
+		{"../test/no-exif.jpg", []string{"exif", "filename", "mtime"}, false, "", "", confidenceNone},
+		{"../test/IMG_20180304_123456.jpg", []string{"filename", "mtime"}, true, "dest/2018/03/IMG_20180304_123456.jpg", "filename", confidenceMedium},
+		{"../test/exif-20180101.jpg", []string{"filename", "exif"}, true, "dest/2018/01/exif-20180101.jpg", "exif", confidenceHigh},
+	}
+
+	defer func() {
+		timeSourceNames = defaultTimeSources
+		useFileTime = false
+	}()
+
+	setDirectoryFormat(t, "yyyy/mm")
+
+	for _, test := range tests {
+		timeSourceNames = test.sources
+		useFileTime = test.useMtime
+
+		files := []*fileinfo{{path: test.path, info: mkInfo(test.path)}}
+		evaluate(files, "dest")
+
+		if files[0].newPath != test.newPath {
+			t.Errorf("%s: newPath expected:%s got:%s", test.path, test.newPath, files[0].newPath)
+		}
+		if files[0].timeSource != test.timeSource {
+			t.Errorf("%s: timeSource expected:%s got:%s", test.path, test.timeSource, files[0].timeSource)
+		}
+		if files[0].confidence != test.confidence {
+			t.Errorf("%s: confidence expected:%s got:%s", test.path, test.confidence, files[0].confidence)
+		}
+	}
+}
+
+func TestLookupTimeSources(t *testing.T) {
+	sources, err := lookupTimeSources([]string{"mtime", "exif"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(sources) != 2 || sources[0].Name() != "mtime" || sources[1].Name() != "exif" {
+		t.Errorf("unexpected sources: %v", sources)
+	}
+
+	if _, err := lookupTimeSources([]string{"exif", "bogus"}); err == nil {
+		t.Error("expected error for unknown source")
+	}
+}
+
+// fakeTimeSource returns fixed candidates for any file.
+type fakeTimeSource struct {
+	name       string
+	times      []time.Time
+	confidence confidence
+}
+
+func (this *fakeTimeSource) Name() string {
+	return this.name
+}
+
+func (this *fakeTimeSource) Extract(file *fileinfo) (time.Time, confidence, error) {
+	return this.times[0], this.confidence, nil
+}
+
+func (this *fakeTimeSource) Candidates(file *fileinfo) ([]timeCandidate, error) {
+	if len(this.times) == 0 {
+		return nil, errNoTime
+	}
+	var candidates []timeCandidate
+	for _, t := range this.times {
+		candidates = append(candidates, timeCandidate{source: this.name, time: t, confidence: this.confidence})
+	}
+	return candidates, nil
+}
+
+func TestTimeConsensus(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+	}
+	exif := func(times ...time.Time) TimeSource {
+		return &fakeTimeSource{"exif", times, confidenceHigh}
+	}
+	filename := func(times ...time.Time) TimeSource {
+		return &fakeTimeSource{"filename", times, confidenceMedium}
+	}
+	mtime := func(times ...time.Time) TimeSource {
+		return &fakeTimeSource{"mtime", times, confidenceLow}
+	}
+
+	tests := []struct {
+		name     string
+		sources  []TimeSource
+		found    bool
+		time     time.Time
+		source   string
+		conflict bool
+	}{
+		{"reset clock", []TimeSource{exif(date(1970, 1, 1, 0, 0, 0)), filename(date(2018, 3, 4, 12, 34, 56))}, true, date(2018, 3, 4, 12, 34, 56), "filename", false},
+		{"future", []TimeSource{exif(date(2080, 1, 1, 0, 0, 0)), filename(date(2018, 3, 4, 12, 34, 56))}, true, date(2018, 3, 4, 12, 34, 56), "filename", false},
+		{"agreement", []TimeSource{exif(date(2018, 3, 4, 12, 34, 56)), filename(date(2018, 3, 4, 12, 34, 58)), mtime(date(2019, 1, 1, 0, 0, 0))}, true, date(2018, 3, 4, 12, 34, 56), "exif", false},
+		{"agreement with later field", []TimeSource{exif(date(2018, 5, 1, 0, 0, 0), date(2018, 3, 4, 12, 34, 56)), filename(date(2018, 3, 4, 0, 0, 0))}, true, date(2018, 3, 4, 12, 34, 56), "exif", true},
+		{"mtime outvotes", []TimeSource{filename(date(2017, 3, 4, 0, 0, 0)), exif(date(2018, 3, 4, 12, 34, 56)), mtime(date(2018, 3, 4, 12, 40, 0))}, true, date(2018, 3, 4, 12, 34, 56), "exif", true},
+		{"tie", []TimeSource{filename(date(2017, 3, 4, 0, 0, 0)), exif(date(2018, 3, 4, 12, 34, 56))}, true, date(2017, 3, 4, 0, 0, 0), "filename", true},
+		{"nothing plausible", []TimeSource{exif(date(1980, 1, 1, 0, 0, 0)), filename()}, false, time.Time{}, "", false},
+	}
+
+	for _, test := range tests {
+		file := &fileinfo{path: test.name}
+		found := determineTime(file, test.sources)
+		if found != test.found {
+			t.Errorf("%s: found expected:%t got:%t", test.name, test.found, found)
+			continue
+		}
+		if !file.time.Equal(test.time) || file.timeSource != test.source {
+			t.Errorf("%s: expected:%s %s got:%s %s", test.name, test.source, test.time, file.timeSource, file.time)
+		}
+		if file.conflict != test.conflict {
+			t.Errorf("%s: conflict expected:%t got:%t", test.name, test.conflict, file.conflict)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var assumeTimeZone string
+var directoryTimeZone string
+
+// assumedZone is the zone of times which carry no zone information, e.g.
+// exif without offset or time encoded in file name. When nil, local zone is
+// used.
+var assumedZone *time.Location
+
+// directoryZone is the zone in which destination directory is computed. When
+// nil, local time of the capture is used, i.e. the time as seen on the
+// camera clock.
+var directoryZone *time.Location
+
+var zoneOffsetRE = regexp.MustCompile(`^([+-])([[:digit:]]{1,2})(?::?([[:digit:]]{2}))?$`)
+
+// parseZone accepts UTC, Local, IANA zone names like Europe/Belgrade and
+// fixed offsets like +02:00, -0530 or +2.
+func parseZone(value string) (*time.Location, error) {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "":
+		return nil, fmt.Errorf("empty time zone")
+	case "z", "utc":
+		return time.UTC, nil
+	case "local":
+		return time.Local, nil
+	}
+
+	if match := zoneOffsetRE.FindStringSubmatch(value); match != nil {
+		hours, _ := strconv.Atoi(match[2])
+		minutes := 0
+		if match[3] != "" {
+			minutes, _ = strconv.Atoi(match[3])
+		}
+		if hours > 14 || minutes > 59 {
+			return nil, fmt.Errorf("invalid time zone offset '%s'", value)
+		}
+		offset := hours*3600 + minutes*60
+		if match[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(value, offset), nil
+	}
+
+	zone, err := time.LoadLocation(value)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone '%s'", value)
+	}
+	return zone, nil
+}
+
+// captureZone is the zone assumed for times without zone information.
+func captureZone() *time.Location {
+	if assumedZone != nil {
+		return assumedZone
+	}
+	return time.Local
+}
+
+// wallTimeIn returns time with the same wall clock reading as t, but in the
+// given zone.
+func wallTimeIn(t time.Time, zone *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone)
+}
+
+// longitudeOffset estimates offset from UTC in seconds using longitude only,
+// i.e. nautical time zone. Political zones may differ by an hour or two.
+func longitudeOffset(long float64) int {
+	return int(math.Round(long/15)) * 3600
+}
+
+func zoneFromLongitude(long float64) *time.Location {
+	return time.FixedZone("", longitudeOffset(long))
+}
+
+// directoryTime returns time to be used for computing destination directory.
+func directoryTime(t time.Time) time.Time {
+	if directoryZone != nil {
+		return t.In(directoryZone)
+	}
+	return t
+}
+
+// initTimeZones parses --assume-tz and --dir-tz flags.
+func initTimeZones() error {
+	assumedZone = nil
+	directoryZone = nil
+
+	var err error
+	if assumeTimeZone != "" {
+		if assumedZone, err = parseZone(assumeTimeZone); err != nil {
+			return fmt.Errorf("--assume-tz: %s", err)
+		}
+	}
+	if directoryTimeZone != "" && strings.ToLower(directoryTimeZone) != "capture" {
+		if directoryZone, err = parseZone(directoryTimeZone); err != nil {
+			return fmt.Errorf("--dir-tz: %s", err)
+		}
+	}
+	return nil
+}
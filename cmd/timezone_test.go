@@ -0,0 +1,179 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestParseZone(t *testing.T) {
+	tests := []struct {
+		value  string
+		offset int
+		err    bool
+	}{
+		{"UTC", 0, false},
+		{"+02:00", 2 * 3600, false},
+		{"-0530", -(5*3600 + 30*60), false},
+		{"+9", 9 * 3600, false},
+		{"Asia/Tokyo", 9 * 3600, false},
+		{"+15:00", 0, true},
+		{"Nowhere/Special", 0, true},
+		{"", 0, true},
+	}
+
+	reference := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		zone, err := parseZone(test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.value, err)
+			continue
+		}
+		if _, offset := reference.In(zone).Zone(); offset != test.offset {
+			t.Errorf("%s: offset expected:%d got:%d", test.value, test.offset, offset)
+		}
+	}
+}
+
+func TestCaptureTimeZone(t *testing.T) {
+	tests := []struct {
+		path    string
+		dirTz   string
+		newPath string
+	}{
+		// both were taken at 00:30 local time, 23:30 the day before in UTC
+		{"../test/tz-offset-20200101.jpg", "", "dest/2020/01/01/tz-offset-20200101.jpg"},
+		{"../test/tz-offset-20200101.jpg", "UTC", "dest/2019/12/31/tz-offset-20200101.jpg"},
+		{"../test/tz-gps-20200101.jpg", "capture", "dest/2020/01/01/tz-gps-20200101.jpg"},
+		{"../test/tz-gps-20200101.jpg", "UTC", "dest/2019/12/31/tz-gps-20200101.jpg"},
+		{"../test/tz-gps-20200101.jpg", "+05:00", "dest/2020/01/01/tz-gps-20200101.jpg"},
+	}
+
+	defer func() {
+		directoryTimeZone = ""
+		directoryZone = nil
+	}()
+
+	setDirectoryFormat(t, "yyyy/mm/dd")
+
+	for _, test := range tests {
+		directoryTimeZone = test.dirTz
+		if err := initTimeZones(); err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.dirTz, err)
+		}
+
+		files := []*fileinfo{{path: test.path, info: mkInfo(test.path)}}
+		evaluate(files, "dest")
+
+		if files[0].newPath != test.newPath {
+			t.Errorf("%s (%s): newPath expected:%s got:%s", test.path, test.dirTz, test.newPath, files[0].newPath)
+		}
+	}
+}
+
+func TestAssumedZone(t *testing.T) {
+	defer func() {
+		assumeTimeZone = ""
+		assumedZone = nil
+	}()
+
+	assumeTimeZone = "-03:00"
+	if err := initTimeZones(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	file := mkFakeFile("IMG_20180304_123456.jpg")
+	got, _, err := (&filenameTimeSource{}).Extract(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := time.Date(2018, 3, 4, 15, 34, 56, 0, time.UTC)
+	if !got.Equal(expected) {
+		t.Errorf("expected:%s got:%s", expected, got)
+	}
+}
+
+// mkGpsExif returns big endian TIFF with DateTimeOriginal and GPS position,
+// but without GPS time.
+func mkGpsExif(dateTime string, lat, long [3]uint32, latRef, longRef string) []byte {
+	var data bytes.Buffer
+	write := func(values ...interface{}) {
+		for _, value := range values {
+			binary.Write(&data, binary.BigEndian, value)
+		}
+	}
+	entry := func(tag, typ uint16, count, value uint32) {
+		write(tag, typ, count, value)
+	}
+	ascii := func(text string) uint32 {
+		var value [4]byte
+		copy(value[:], text)
+		return binary.BigEndian.Uint32(value[:])
+	}
+
+	data.WriteString("MM\x00\x2a")
+	write(uint32(8))
+	// IFD0 at 8, Exif IFD at 38, date at 56, GPS IFD at 76, rationals at 130
+	write(uint16(2))
+	entry(0x8769, 4, 1, 38)
+	entry(0x8825, 4, 1, 76)
+	write(uint32(0))
+	write(uint16(1))
+	entry(0x9003, 2, 20, 56)
+	write(uint32(0))
+	data.WriteString(dateTime + "\x00")
+	write(uint16(4))
+	entry(0x0001, 2, 2, ascii(latRef))
+	entry(0x0002, 5, 3, 130)
+	entry(0x0003, 2, 2, ascii(longRef))
+	entry(0x0004, 5, 3, 154)
+	write(uint32(0))
+	for _, value := range append(lat[:], long[:]...) {
+		write(value, uint32(1))
+	}
+	return data.Bytes()
+}
+
+func TestExifZoneAssumedOverLongitude(t *testing.T) {
+	defer func() { assumedZone = nil }()
+
+	// Kashgar is five hours east of Greenwich by longitude, but uses China
+	// standard time
+	data := mkGpsExif("2020:07:01 12:00:00", [3]uint32{39, 28, 0}, [3]uint32{75, 59, 0}, "N", "E")
+	x, err := decodeTiffExif(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	wall := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	assumedZone = nil
+	if _, offset := wall.In(exifZone(x, wall, exifOffsetTimeOriginal)).Zone(); offset != 5*3600 {
+		t.Errorf("unexpected offset estimated from longitude: %d", offset)
+	}
+
+	assumedZone = time.FixedZone("", 8*3600)
+	if _, offset := wall.In(exifZone(x, wall, exifOffsetTimeOriginal)).Zone(); offset != 8*3600 {
+		t.Errorf("expected offset of --assume-tz, got: %d", offset)
+	}
+}
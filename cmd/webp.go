@@ -0,0 +1,66 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// decodeWebp reads EXIF and XMP chunks of WebP RIFF container.
+func decodeWebp(r io.ReaderAt, size int64) (*embeddedMetadata, error) {
+	header := make([]byte, 12)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("webp: reading header: %s", err)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return nil, errors.New("webp: not a webp file")
+	}
+	end := 8 + int64(binary.LittleEndian.Uint32(header[4:8]))
+	if end > size {
+		end = size
+	}
+
+	metadata := &embeddedMetadata{}
+	chunk := make([]byte, 8)
+	for offset := int64(12); offset+8 <= end; {
+		if _, err := r.ReadAt(chunk, offset); err != nil {
+			return nil, fmt.Errorf("webp: reading chunk at %d: %s", offset, err)
+		}
+		typ := string(chunk[0:4])
+		length := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		if offset+8+length > end {
+			return nil, fmt.Errorf("webp: chunk %s exceeds file size", typ)
+		}
+
+		if typ == "EXIF" || typ == "XMP " {
+			data := make([]byte, length)
+			if _, err := r.ReadAt(data, offset+8); err != nil {
+				return nil, fmt.Errorf("webp: reading %s chunk: %s", typ, err)
+			}
+			if typ == "EXIF" {
+				// some writers keep jpeg APP1 header
+				metadata.exif = bytes.TrimPrefix(data, jpegExifHeader)
+			} else {
+				metadata.xmp = data
+			}
+		}
+		offset += 8 + length + length%2 // chunks are padded to even size
+	}
+	return metadata, nil
+}
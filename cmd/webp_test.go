@@ -0,0 +1,76 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func mkRiffChunk(typ string, data []byte) []byte {
+	chunk := append([]byte(typ), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func mkWebp(chunks ...[]byte) []byte {
+	payload := append([]byte("WEBP"), mkRiffChunk("VP8X", make([]byte, 10))...)
+	for _, chunk := range chunks {
+		payload = append(payload, chunk...)
+	}
+	data := append([]byte("RIFF"), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(payload)))
+	return append(data, payload...)
+}
+
+func TestDecodeWebp(t *testing.T) {
+	exif := readTestExif(t)
+	tests := []struct {
+		name string
+		data []byte
+		exif bool
+		xmp  string
+	}{
+		{"exif", mkWebp(mkRiffChunk("VP8 ", make([]byte, 11)), mkRiffChunk("EXIF", exif)), true, ""},
+		{"exif with header", mkWebp(mkRiffChunk("EXIF", append(append([]byte(nil), jpegExifHeader...), exif...))), true, ""},
+		{"xmp", mkWebp(mkRiffChunk("XMP ", []byte("<x:xmpmeta/>"))), false, "<x:xmpmeta/>"},
+		{"none", mkWebp(), false, ""},
+	}
+
+	for _, test := range tests {
+		metadata, err := decodeWebp(bytes.NewReader(test.data), int64(len(test.data)))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if test.exif != bytes.Equal(metadata.exif, exif) {
+			t.Errorf("%s: unexpected exif: % x", test.name, metadata.exif)
+		}
+		if string(metadata.xmp) != test.xmp {
+			t.Errorf("%s: xmp expected:%s got:%s", test.name, test.xmp, metadata.xmp)
+		}
+	}
+
+	for _, data := range [][]byte{[]byte("RIFF\x04\x00\x00\x00WAVE"), mkWebp(mkRiffChunk("EXIF", exif))[:40]} {
+		if _, err := decodeWebp(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("expected error for % x", data)
+		}
+	}
+}
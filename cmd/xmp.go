@@ -0,0 +1,372 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Namespaces of XMP properties we read.
+const (
+	xmpNamespaceRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xmpNamespaceXMP       = "http://ns.adobe.com/xap/1.0/"
+	xmpNamespaceExif      = "http://ns.adobe.com/exif/1.0/"
+	xmpNamespaceDC        = "http://purl.org/dc/elements/1.1/"
+	xmpNamespacePhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+)
+
+var (
+	xmpDescription      = xml.Name{Space: xmpNamespaceRDF, Local: "Description"}
+	xmpListItem         = xml.Name{Space: xmpNamespaceRDF, Local: "li"}
+	xmpDateTimeOriginal = xml.Name{Space: xmpNamespaceExif, Local: "DateTimeOriginal"}
+	xmpCreateDate       = xml.Name{Space: xmpNamespaceXMP, Local: "CreateDate"}
+	xmpRating           = xml.Name{Space: xmpNamespaceXMP, Local: "Rating"}
+	xmpSubject          = xml.Name{Space: xmpNamespaceDC, Local: "subject"}
+	xmpDateCreated      = xml.Name{Space: xmpNamespacePhotoshop, Local: "DateCreated"}
+)
+
+// xmpTimeFields lists XMP dates in order of preference, with names used in
+// output.
+var xmpTimeFields = []struct {
+	name  xml.Name
+	field string
+}{
+	{xmpDateTimeOriginal, "exif:DateTimeOriginal"},
+	{xmpDateCreated, "photoshop:DateCreated"},
+	{xmpCreateDate, "xmp:CreateDate"},
+}
+
+// jpegXmpHeader starts APP1 segment holding XMP packet.
+var jpegXmpHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// xmpMetadata holds properties read from XMP packet.
+type xmpMetadata struct {
+	properties map[xml.Name]string
+	subject    []string
+}
+
+// parseXmp reads properties from XMP packet. Simple properties may be stored
+// either as attributes of rdf:Description or as child elements, while
+// dc:subject is a bag of keywords.
+func parseXmp(data []byte) (*xmpMetadata, error) {
+	metadata := &xmpMetadata{properties: make(map[xml.Name]string)}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var path []xml.Name
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("xmp: %s", err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name == xmpDescription {
+				for _, attr := range token.Attr {
+					metadata.set(attr.Name, attr.Value)
+				}
+			}
+			path = append(path, token.Name)
+			text.Reset()
+		case xml.CharData:
+			text.Write(token)
+		case xml.EndElement:
+			if len(path) == 0 {
+				return nil, fmt.Errorf("xmp: unexpected end of %s", token.Name.Local)
+			}
+			path = path[:len(path)-1]
+			value := strings.TrimSpace(text.String())
+			text.Reset()
+			if value == "" {
+				continue
+			}
+			if token.Name == xmpListItem {
+				// property / rdf:Bag / rdf:li
+				if len(path) >= 2 && path[len(path)-2] == xmpSubject {
+					metadata.subject = append(metadata.subject, value)
+				}
+				continue
+			}
+			metadata.set(token.Name, value)
+		}
+	}
+	return metadata, nil
+}
+
+func (this *xmpMetadata) set(name xml.Name, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	if _, ok := this.properties[name]; !ok {
+		this.properties[name] = value
+	}
+}
+
+// merge adds properties missing in this from other.
+func (this *xmpMetadata) merge(other *xmpMetadata) {
+	for name, value := range other.properties {
+		this.set(name, value)
+	}
+	if len(this.subject) == 0 {
+		this.subject = other.subject
+	}
+}
+
+// rating returns xmp:Rating; -1 means rejected, 0 unrated and 1-5 stars.
+func (this *xmpMetadata) rating() (int, bool) {
+	value, ok := this.properties[xmpRating]
+	if !ok {
+		return 0, false
+	}
+	rating, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int(math.Round(rating)), true
+}
+
+// xmpDateRE matches XMP dates, which are ISO 8601 dates of varying precision,
+// e.g. 2019, 2019-06, 2019-06-26T10:00, 2019-06-26T10:00:00.123+02:00.
+var xmpDateRE = regexp.MustCompile(`^([[:digit:]]{4})(?:-([[:digit:]]{2})(?:-([[:digit:]]{2})(?:T([[:digit:]]{2}):([[:digit:]]{2})(?::([[:digit:]]{2})(?:\.[[:digit:]]+)?)?(Z|[+-][[:digit:]]{2}:?[[:digit:]]{2})?)?)?)?$`)
+
+// parseXmpDate parses XMP date. Dates without zone are in capture zone.
+func parseXmpDate(value string) (time.Time, timePrecision, bool) {
+	match := xmpDateRE.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return time.Time{}, precisionFull, false
+	}
+
+	precision := precisionFull
+	year, month, day := atoi(match[1]), 1, 1
+	switch {
+	case match[2] == "":
+		precision = precisionYear
+	case match[3] == "":
+		month = atoi(match[2])
+		precision = precisionMonth
+	case match[4] == "":
+		month, day = atoi(match[2]), atoi(match[3])
+		precision = precisionDay
+	default:
+		month, day = atoi(match[2]), atoi(match[3])
+	}
+	if month < 1 || month > 12 || !validDate(year, month, day) {
+		return time.Time{}, precisionFull, false
+	}
+
+	zone := captureZone()
+	if match[7] != "" {
+		var err error
+		if zone, err = parseZone(match[7]); err != nil {
+			return time.Time{}, precisionFull, false
+		}
+	}
+	t := time.Date(year, time.Month(month), day, atoi(match[4]), atoi(match[5]), atoi(match[6]), 0, zone)
+	return t, precision, true
+}
+
+// readJpegXmp returns XMP packet embedded in JPEG file, or nil if there is
+// none.
+func readJpegXmp(r io.ReaderAt) ([]byte, error) {
+	segments, err := readJpegSegments(r)
+	if err != nil {
+		return nil, err
+	}
+	segment, err := findJpegSegment(r, segments, jpegAPP1, jpegXmpHeader)
+	if err != nil || segment == nil {
+		return nil, err
+	}
+	data := make([]byte, segment.length-int64(len(jpegXmpHeader)))
+	if _, err := r.ReadAt(data, segment.offset+int64(len(jpegXmpHeader))); err != nil {
+		return nil, fmt.Errorf("jpeg: reading xmp: %s", err)
+	}
+	return data, nil
+}
+
+// findXmpSidecars returns XMP sidecars of the media, named either by
+// appending .xmp to the name (darktable) or by replacing the extension
+// (Lightroom). Returned suffixes rebuild the name from the new path of the
+// media.
+func findXmpSidecars(path string) []sidecarFile {
+	ext := filepath.Ext(path)
+	if strings.EqualFold(ext, ".xmp") {
+		return nil
+	}
+	stem := strings.TrimSuffix(path, ext)
+
+	var sidecars []sidecarFile
+	var found []os.FileInfo
+	for _, candidate := range []sidecarFile{
+		{path: path + ".xmp", suffix: ".xmp", stem: false},
+		{path: path + ".XMP", suffix: ".XMP", stem: false},
+		{path: stem + ".xmp", suffix: ".xmp", stem: true},
+		{path: stem + ".XMP", suffix: ".XMP", stem: true},
+	} {
+		info, err := os.Stat(candidate.path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		duplicate := false
+		for _, other := range found {
+			// case insensitive file systems
+			duplicate = duplicate || os.SameFile(info, other)
+		}
+		if !duplicate {
+			found = append(found, info)
+			sidecars = append(sidecars, candidate)
+		}
+	}
+	return sidecars
+}
+
+// readXmp returns XMP from sidecars of the file merged with the one embedded
+// in the file, sidecars taking precedence.
+func readXmp(file *fileinfo) (*xmpMetadata, error) {
+	var metadata *xmpMetadata
+	add := func(data []byte, source string) error {
+		xmp, err := parseXmp(data)
+		if err != nil {
+			return fmt.Errorf("%s: %s", source, err)
+		}
+		if metadata == nil {
+			metadata = xmp
+		} else {
+			metadata.merge(xmp)
+		}
+		return nil
+	}
+
+	for _, sidecar := range findXmpSidecars(file.path) {
+		data, err := ioutil.ReadFile(sidecar.path)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(data, sidecar.path); err != nil {
+			return nil, err
+		}
+	}
+
+	ext := file.mediaType()
+	if jpegFileTypes[ext] {
+		is, err := os.Open(file.path)
+		if err != nil {
+			return nil, err
+		}
+		defer is.Close()
+		if data, err := readJpegXmp(is); err == nil && data != nil {
+			if err := add(data, file.path); err != nil {
+				return nil, err
+			}
+		}
+	} else if decode, ok := embeddedMetadataDecoders[ext]; ok {
+		is, err := os.Open(file.path)
+		if err != nil {
+			return nil, err
+		}
+		defer is.Close()
+		info, err := is.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if embedded, err := decode(is, info.Size()); err == nil && embedded.xmp != nil {
+			if err := add(embedded.xmp, file.path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return metadata, nil
+}
+
+// storeXmpMetadata stores rating and keywords from XMP into file metadata.
+func storeXmpMetadata(file *fileinfo, metadata *xmpMetadata) {
+	if rating, ok := metadata.rating(); ok {
+		file.setMetadata(metadataRating, strconv.Itoa(rating))
+	}
+	file.addKeywords(metadata.subject)
+}
+
+// readXmpMetadata stores rating and keywords of the file into its metadata,
+// for filters and formats when xmp time source is not used.
+func readXmpMetadata(file *fileinfo) error {
+	metadata, err := readXmp(file)
+	if err != nil || metadata == nil {
+		return err
+	}
+	storeXmpMetadata(file, metadata)
+	return nil
+}
+
+// xmpTimeSource reads time from XMP sidecars and XMP embedded in JPEG, PNG,
+// WebP and GIF files. Rating and keywords are stored into file metadata.
+type xmpTimeSource struct{}
+
+func (xmpTimeSource) Name() string {
+	return "xmp"
+}
+
+func (this xmpTimeSource) Extract(file *fileinfo) (time.Time, confidence, error) {
+	candidates, err := this.Candidates(file)
+	if err != nil {
+		return time.Time{}, confidenceNone, err
+	}
+	return candidates[0].time, candidates[0].confidence, nil
+}
+
+// Candidates returns times from all XMP date properties present.
+func (xmpTimeSource) Candidates(file *fileinfo) ([]timeCandidate, error) {
+	metadata, err := readXmp(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading xmp (%s)", err)
+	} else if metadata == nil {
+		return nil, errNoTime
+	}
+
+	storeXmpMetadata(file, metadata)
+
+	var candidates []timeCandidate
+	for _, field := range xmpTimeFields {
+		t, precision, ok := parseXmpDate(metadata.properties[field.name])
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, timeCandidate{
+			source:     "xmp",
+			field:      field.field,
+			time:       t,
+			precision:  precision,
+			confidence: confidenceHigh,
+		})
+	}
+	if len(candidates) == 0 {
+		return nil, errNoTime
+	}
+	return candidates, nil
+}
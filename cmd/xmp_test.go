@@ -0,0 +1,259 @@
+// Copyright © 2018 Milutin Jovanović jovanovic.milutin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const sidecarXmp = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmp:Rating="4"
+    exif:DateTimeOriginal="2016-07-10T09:08:07">
+   <xmp:CreateDate>2016-07-10T09:08:07+02:00</xmp:CreateDate>
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>holiday</rdf:li>
+     <rdf:li>Croatia</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+const embeddedXmp = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmp:Rating="1"
+    photoshop:DateCreated="2009-07">
+   <dc:subject><rdf:Bag><rdf:li>scan</rdf:li></rdf:Bag></dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+// mkJpegWithXmp returns minimal jpeg with XMP in APP1 segment.
+func mkJpegWithXmp(xmp string) []byte {
+	payload := append([]byte(nil), jpegXmpHeader...)
+	payload = append(payload, xmp...)
+	length := len(payload) + 2
+	data := []byte{0xff, 0xd8, 0xff, jpegAPP1, byte(length >> 8), byte(length)}
+	data = append(data, payload...)
+	return append(data, 0xff, jpegEOI)
+}
+
+func TestParseXmp(t *testing.T) {
+	metadata, err := parseXmp([]byte(sidecarXmp))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if metadata.properties[xmpDateTimeOriginal] != "2016-07-10T09:08:07" {
+		t.Errorf("unexpected DateTimeOriginal: %v", metadata.properties)
+	}
+	if metadata.properties[xmpCreateDate] != "2016-07-10T09:08:07+02:00" {
+		t.Errorf("unexpected CreateDate: %v", metadata.properties)
+	}
+	if rating, ok := metadata.rating(); !ok || rating != 4 {
+		t.Errorf("unexpected rating: %d", rating)
+	}
+	if !reflect.DeepEqual(metadata.subject, []string{"holiday", "Croatia"}) {
+		t.Errorf("unexpected subject: %v", metadata.subject)
+	}
+
+	if _, err := parseXmp([]byte("<x:xmpmeta><rdf:RDF>")); err == nil {
+		t.Error("expected error for truncated xmp")
+	}
+}
+
+func TestParseXmpDate(t *testing.T) {
+	tests := []struct {
+		value     string
+		expected  time.Time
+		precision timePrecision
+		ok        bool
+	}{
+		{"2016-07-10T09:08:07+02:00", time.Date(2016, 7, 10, 7, 8, 7, 0, time.UTC), precisionFull, true},
+		{"2016-07-10T09:08:07.25Z", time.Date(2016, 7, 10, 9, 8, 7, 0, time.UTC), precisionFull, true},
+		{"2016-07-10T09:08-0100", time.Date(2016, 7, 10, 10, 8, 0, 0, time.UTC), precisionFull, true},
+		{"2016-07-10T09:08:07", time.Date(2016, 7, 10, 9, 8, 7, 0, time.Local), precisionFull, true},
+		{"2016-07-10", time.Date(2016, 7, 10, 0, 0, 0, 0, time.Local), precisionDay, true},
+		{"2016-07", time.Date(2016, 7, 1, 0, 0, 0, 0, time.Local), precisionMonth, true},
+		{"2016", time.Date(2016, 1, 1, 0, 0, 0, 0, time.Local), precisionYear, true},
+		{"2016-13", time.Time{}, precisionFull, false},
+		{"2016:07:10 09:08:07", time.Time{}, precisionFull, false},
+	}
+
+	for _, test := range tests {
+		got, precision, ok := parseXmpDate(test.value)
+		if ok != test.ok || !got.Equal(test.expected) || precision != test.precision {
+			t.Errorf("%s: expected:%s (%s) got:%s (%s)", test.value, test.expected, test.precision, got, precision)
+		}
+	}
+}
+
+func TestXmpTimeSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, contents := range map[string][]byte{
+		"IMG_0001.CR2":     []byte("raw"),
+		"IMG_0001.CR2.xmp": []byte(sidecarXmp),
+		"scan.jpg":         mkJpegWithXmp(embeddedXmp),
+		"scan.xmp":         []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"/>`),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	raw := &fileinfo{path: filepath.Join(dir, "IMG_0001.CR2")}
+	candidates, err := xmpTimeSource{}.Candidates(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(candidates) != 2 || candidates[0].field != "exif:DateTimeOriginal" || candidates[1].field != "xmp:CreateDate" {
+		t.Errorf("unexpected candidates: %v", candidates)
+	}
+	if raw.metadata[metadataRating] != "4" || raw.metadata[metadataKeywords] != "holiday, Croatia" {
+		t.Errorf("unexpected metadata: %v", raw.metadata)
+	}
+	findSidecars([]*fileinfo{raw})
+	if len(raw.sidecars) != 1 || raw.sidecars[0].newPath("dest/IMG_0001-1.CR2") != "dest/IMG_0001-1.CR2.xmp" {
+		t.Errorf("unexpected sidecars: %v", raw.sidecars)
+	}
+
+	scan := &fileinfo{path: filepath.Join(dir, "scan.jpg")}
+	candidates, err = xmpTimeSource{}.Candidates(scan)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(candidates) != 1 || candidates[0].precision != precisionMonth || candidates[0].field != "photoshop:DateCreated" {
+		t.Errorf("unexpected candidates: %v", candidates)
+	}
+	if scan.metadata[metadataRating] != "1" || scan.metadata[metadataKeywords] != "scan" {
+		t.Errorf("unexpected metadata: %v", scan.metadata)
+	}
+	findSidecars([]*fileinfo{scan})
+	if len(scan.sidecars) != 1 || scan.sidecars[0].newPath("dest/scan-1.jpg") != "dest/scan-1.xmp" {
+		t.Errorf("unexpected sidecars: %v", scan.sidecars)
+	}
+}
+
+func TestFilterReason(t *testing.T) {
+	defer func() {
+		minRating = -1
+		requiredKeywords = nil
+	}()
+
+	tests := []struct {
+		metadata  map[string]string
+		keywords  []string
+		minRating int
+		required  []string
+		excluded  bool
+	}{
+		{nil, nil, -1, nil, false},
+		{nil, nil, 1, nil, true},
+		{map[string]string{metadataRating: "-1"}, nil, 0, nil, true},
+		{map[string]string{metadataRating: "3"}, nil, 3, nil, false},
+		{nil, []string{"holiday", "Croatia"}, -1, []string{"croatia"}, false},
+		{nil, []string{"holiday", "Croatia"}, -1, []string{"work"}, true},
+		{nil, nil, -1, []string{"work"}, true},
+	}
+
+	for i, test := range tests {
+		minRating = test.minRating
+		requiredKeywords = test.required
+		reason := filterReason(&fileinfo{metadata: test.metadata, keywords: test.keywords})
+		if (reason != "") != test.excluded {
+			t.Errorf("%d: unexpected result '%s'", i, reason)
+		}
+	}
+}
+
+func TestFormatDirectory(t *testing.T) {
+	file := &fileinfo{metadata: map[string]string{metadataModel: "Canon EOS 80D", metadataKeywords: "a/b"}}
+	format := "yyyy/{model}/{Keywords}/{Rating}-mm"
+	got := mustParseTemplate(t, format, true).format(time.Date(2016, 7, 10, 0, 0, 0, 0, time.UTC), file, 0)
+	if got != "2016/Canon EOS 80D/a-b/unknown-07" {
+		t.Errorf("unexpected directory: %s", got)
+	}
+}
+
+func TestXmpMetadataWithoutTimeSource(t *testing.T) {
+	jpeg, err := ioutil.ReadFile("../test/exif-20180101.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "xmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, contents := range map[string][]byte{
+		"rated.jpg":     jpeg,
+		"rated.jpg.xmp": []byte(sidecarXmp),
+		"unrated.jpg":   jpeg,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func() {
+		useXmpTime = true
+		minRating = -1
+	}()
+	useXmpTime = false
+	minRating = 1
+	setDirectoryFormat(t, "yyyy/mm/dd")
+	allFiles = false
+	minSize = 0
+
+	files, err := getFiles(dir, acceptExifFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	evaluate(files, "dest")
+	for _, file := range files {
+		switch filepath.Base(file.path) {
+		case "rated.jpg":
+			if file.newPath == "" || file.metadata[metadataRating] != "4" {
+				t.Errorf("%s: unexpected skip: %s %v", file.path, file.message, file.metadata)
+			}
+		case "unrated.jpg":
+			if file.newPath != "" {
+				t.Errorf("%s: unexpected newPath: %s", file.path, file.newPath)
+			}
+		}
+	}
+}